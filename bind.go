@@ -0,0 +1,349 @@
+package mux
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError describes an invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError reports the invalid fields of a request. Binding errors
+// have status 400 Bad Request and failed validation rules 422 Unprocessable
+// Entity.
+type ValidationError struct {
+	Status int
+	Errors []FieldError
+}
+
+// Error lists the invalid fields.
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, field := range e.Errors {
+		if field.Field == "" {
+			parts = append(parts, field.Message)
+			continue
+		}
+		parts = append(parts, field.Field+": "+field.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// StatusCode returns the status of the error.
+func (e *ValidationError) StatusCode() int {
+	return e.Status
+}
+
+const defaultFormMemory = 32 << 20
+
+var (
+	textUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+	durationType    = reflect.TypeFor[time.Duration]()
+	timeType        = reflect.TypeFor[time.Time]()
+	fileType        = reflect.TypeFor[*multipart.FileHeader]()
+	filesType       = reflect.TypeFor[[]*multipart.FileHeader]()
+)
+
+// Bind fills the struct pointed to by dst from the request using the tags
+// of its fields:
+//
+//	query:"page"           a query parameter
+//	form:"name"            a field of an url-encoded or multipart form body
+//	header:"X-Request-Id"  a request header
+//	cookie:"session"       a cookie
+//	path:"id"              a path value
+//
+// Values are converted to strings, bools, integers, floats, time.Duration,
+// time.Time (RFC 3339, or the layout of a layout tag, ex.
+// `query:"from" layout:"2006-01-02"`), types implementing
+// encoding.TextUnmarshaler, pointers to them and slices of them. Form
+// fields of type *multipart.FileHeader or []*multipart.FileHeader receive
+// uploaded files. Fields without a value are left unchanged, so defaults
+// can be set before calling Bind.
+//
+// All invalid values are reported in a ValidationError with status 400 Bad
+// Request, which Error renders with the invalid fields. Use Validate to
+// check the bound values, ex.
+//
+//	var filter struct {
+//		Page  int      `query:"page" validate:"min=1"`
+//		Tags  []string `query:"tag"`
+//		Token string   `header:"Authorization"`
+//	}
+//	if err := mux.Bind(r, &filter); err != nil {
+//		mux.Error(w, r, err)
+//		return
+//	}
+func Bind(r *http.Request, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		panic("mux.Bind: dst must be a non-nil pointer to a struct")
+	}
+	sources := []string{"path", "query", "header", "cookie"}
+	if usesTag(v.Elem().Type(), "form") {
+		if err := parseForm(r); err != nil {
+			return err
+		}
+		sources = append(sources, "form")
+	}
+	if errs := bindRequest(r, v.Elem(), sources...); len(errs) > 0 {
+		return &ValidationError{Status: http.StatusBadRequest, Errors: errs}
+	}
+	return nil
+}
+
+// parseForm parses an url-encoded or multipart form body.
+func parseForm(r *http.Request) error {
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(defaultFormMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err == nil {
+		return nil
+	}
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return &HTTPError{Status: http.StatusRequestEntityTooLarge, Err: err}
+	}
+	return &HTTPError{Status: http.StatusBadRequest, Message: "invalid form", Err: err}
+}
+
+// bindSource looks up the values of a tag.
+type bindSource struct {
+	tag    string
+	lookup func(name string) ([]string, bool)
+	files  func(name string) []*multipart.FileHeader
+}
+
+// bindRequest sets the fields of the struct v from the given sources of the
+// request, ex. "path" and "query". Forms must already be parsed.
+func bindRequest(r *http.Request, v reflect.Value, sources ...string) []FieldError {
+	var errs []FieldError
+	for _, tag := range sources {
+		source := bindSource{tag: tag}
+		switch tag {
+		case "path":
+			source.lookup = func(name string) ([]string, bool) {
+				value := r.PathValue(name)
+				return []string{value}, value != ""
+			}
+		case "query":
+			query := r.URL.Query()
+			source.lookup = func(name string) ([]string, bool) {
+				values, ok := query[name]
+				return values, ok
+			}
+		case "header":
+			source.lookup = func(name string) ([]string, bool) {
+				values := r.Header.Values(name)
+				return values, len(values) > 0
+			}
+		case "cookie":
+			source.lookup = func(name string) ([]string, bool) {
+				cookie, err := r.Cookie(name)
+				if err != nil {
+					return nil, false
+				}
+				return []string{cookie.Value}, true
+			}
+		case "form":
+			source.lookup = func(name string) ([]string, bool) {
+				values, ok := r.PostForm[name]
+				return values, ok
+			}
+			source.files = func(name string) []*multipart.FileHeader {
+				if r.MultipartForm == nil {
+					return nil
+				}
+				return r.MultipartForm.File[name]
+			}
+		}
+		errs = append(errs, bindValues(v, source)...)
+	}
+	return errs
+}
+
+// bindValues sets the fields of the struct v tagged with the tag of source
+// to the values returned by its lookup, ex. `query:"page"`.
+func bindValues(v reflect.Value, source bindSource) []FieldError {
+	var errs []FieldError
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name, ok := field.Tag.Lookup(source.tag)
+		if !ok {
+			if field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct {
+				if embedded, ok := allocate(v.Field(i)); ok {
+					errs = append(errs, bindValues(embedded, source)...)
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ = strings.Cut(name, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if field.Type == fileType || field.Type == filesType {
+			bindFiles(v.Field(i), source, name)
+			continue
+		}
+		values, found := source.lookup(name)
+		if !found || len(values) == 0 {
+			continue
+		}
+		if err := setValue(v.Field(i), values, field.Tag.Get("layout")); err != nil {
+			errs = append(errs, FieldError{Field: name, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+func bindFiles(v reflect.Value, source bindSource, name string) {
+	if source.files == nil {
+		return
+	}
+	files := source.files(name)
+	if len(files) == 0 {
+		return
+	}
+	if v.Type() == fileType {
+		v.Set(reflect.ValueOf(files[0]))
+		return
+	}
+	v.Set(reflect.ValueOf(files))
+}
+
+// usesTag reports whether a field of the struct type t has the tag.
+func usesTag(t reflect.Type, tag string) bool {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+		if field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct &&
+			usesTag(indirectType(field.Type), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// setValue converts values to the type of v. Times are parsed with layout,
+// or RFC 3339 if it is empty.
+func setValue(v reflect.Value, values []string, layout string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), values, layout)
+	}
+	switch {
+	case v.Type() == timeType:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, values[0])
+		if err != nil {
+			return errors.New("must be a time formatted as " + layout)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(values[0])
+		if err != nil {
+			return errors.New("must be a duration")
+		}
+		v.SetInt(int64(d))
+		return nil
+	case reflect.PointerTo(v.Type()).Implements(textUnmarshaler):
+		err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+		if err != nil {
+			return errors.New("is invalid")
+		}
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), []string{value}, layout); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setScalar(v, values[0])
+}
+
+func setScalar(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a non-negative integer")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// allocate returns the struct v points to, allocating it if needed.
+func allocate(v reflect.Value) (reflect.Value, bool) {
+	if v.Kind() != reflect.Pointer {
+		return v, true
+	}
+	if v.IsNil() {
+		if !v.CanSet() {
+			return v, false
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	return v.Elem(), true
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,104 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pagination struct {
+	Page  int `query:"page"`
+	Limit int `query:"limit"`
+}
+
+type search struct {
+	pagination
+
+	ID        uint64        `path:"id"`
+	Tags      []string      `query:"tag"`
+	Since     time.Time     `query:"since" layout:"2006-01-02"`
+	Timeout   time.Duration `query:"timeout"`
+	Exact     *bool         `query:"exact"`
+	Addr      netip.Addr    `query:"addr"`
+	RequestID string        `header:"X-Request-Id"`
+	Session   string        `cookie:"session"`
+	Name      string        `form:"name"`
+	Scores    []float64     `form:"score"`
+}
+
+func TestBind(t *testing.T) {
+	form := url.Values{"name": {"ann"}, "score": {"1.5", "2"}}
+	req := httptest.NewRequest(http.MethodPost, "/search/7?page=2&tag=a&tag=b"+
+		"&since=2024-03-01&timeout=1m30s&exact=true&addr=192.0.2.1",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Request-Id", "abc")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s3cr3t"})
+	req.SetPathValue("id", "7")
+
+	dst := search{pagination: pagination{Limit: 20}}
+	if err := Bind(req, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.ID != 7 || dst.Page != 2 || dst.Limit != 20 ||
+		!slices.Equal(dst.Tags, []string{"a", "b"}) {
+		t.Error("expected 7 2 20 [a b], got", dst.ID, dst.Page, dst.Limit, dst.Tags)
+	}
+	if !dst.Since.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) ||
+		dst.Timeout != 90*time.Second || dst.Exact == nil || !*dst.Exact ||
+		dst.Addr.String() != "192.0.2.1" {
+		t.Error("expected converted values, got", dst.Since, dst.Timeout, dst.Exact, dst.Addr)
+	}
+	if dst.RequestID != "abc" || dst.Session != "s3cr3t" || dst.Name != "ann" ||
+		!slices.Equal(dst.Scores, []float64{1.5, 2}) {
+		t.Error("expected abc s3cr3t ann [1.5 2], got", dst.RequestID, dst.Session, dst.Name,
+			dst.Scores)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet,
+		"/?page=two&since=yesterday&timeout=long&addr=nowhere", nil)
+	var dst search
+	err := Bind(req, &dst)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Status != http.StatusBadRequest {
+		t.Fatal("expected ValidationError, got", err)
+	}
+	want := "page: must be an integer; since: must be a time formatted as 2006-01-02; " +
+		"timeout: must be a duration; addr: is invalid"
+	if err.Error() != want {
+		t.Errorf("Expected '%s', got '%s'", want, err.Error())
+	}
+}
+
+func TestBindMultipart(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("title", "report")
+	part, _ := writer.CreateFormFile("attachment", "report.txt")
+	part.Write([]byte("quarterly numbers"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var dst struct {
+		Title      string                `form:"title"`
+		Attachment *multipart.FileHeader `form:"attachment"`
+	}
+	if err := Bind(req, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Title != "report" || dst.Attachment == nil ||
+		dst.Attachment.Filename != "report.txt" || dst.Attachment.Size != 17 {
+		t.Error("expected report report.txt 17, got", dst.Title, dst.Attachment)
+	}
+}
@@ -0,0 +1,297 @@
+package mux
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultMaxRatio = 100
+	// minRatioBase is the compressed size below which the ratio limit of
+	// Decompress is not applied, so that small bodies may compress well.
+	minRatioBase = 1024
+)
+
+var errDecompressionBomb = errors.New("decompressed body exceeds limit")
+
+// ErrorFunc writes an error response with the given status code.
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, status int)
+
+// BodyLimitOptions configures BodyLimit.
+type BodyLimitOptions struct {
+	// Limit is the maximum size of a request body in bytes.
+	Limit int64
+	// OnError renders the 413 Request Entity Too Large response.
+	// Defaults to the error renderer of the router, see Router.RenderErrors.
+	OnError ErrorFunc
+}
+
+// MaxBodySize is a middleware that limits request bodies to limit bytes.
+// See BodyLimit.
+func MaxBodySize(limit int64) Middleware {
+	return BodyLimit(BodyLimitOptions{Limit: limit})
+}
+
+// BodyLimit is a middleware that limits the size of request bodies.
+// Reading past the limit, or reading a body with a larger Content-Length,
+// returns a *http.MaxBytesError and the response of the handler is replaced
+// with a 413 response.
+//
+// The limit set closest to the route wins, so a limit for a Group or a
+// route registered using With replaces the limit of the router, ex.
+// router.Use(mux.MaxBodySize(1 << 20))
+// router.With(mux.MaxBodySize(1 << 30)).Post("/upload", upload) .
+func BodyLimit(options BodyLimitOptions) Middleware {
+	if options.OnError == nil {
+		options.OnError = defaultError
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if body, ok := r.Body.(*limitedBody); ok {
+				body.limit = options.Limit
+				body.onError = options.OnError
+				next.ServeHTTP(w, r)
+				return
+			}
+			guard := &bodyGuard{ResponseWriter: w, request: r}
+			r.Body = &limitedBody{
+				ReadCloser: r.Body,
+				guard:      guard,
+				limit:      options.Limit,
+				length:     r.ContentLength,
+				onError:    options.OnError,
+			}
+			next.ServeHTTP(guard, r)
+			guard.finish()
+		})
+	}
+}
+
+// DecompressOptions configures Decompress.
+type DecompressOptions struct {
+	// MaxRatio is the maximum ratio of decompressed to compressed bytes.
+	// Defaults to 100.
+	MaxRatio int64
+	// MaxSize is the maximum size of a decompressed body in bytes.
+	// Unlimited when zero.
+	MaxSize int64
+	// OnError renders the 400 Bad Request response for invalid or corrupt
+	// bodies and the 413 Request Entity Too Large and 415 Unsupported Media
+	// Type responses. Defaults to the error renderer of the router.
+	OnError ErrorFunc
+}
+
+// Decompress is a middleware that transparently decompresses request bodies
+// with a gzip or deflate Content-Encoding. Bodies that expand beyond
+// MaxRatio or MaxSize are treated like a decompression bomb: reading
+// fails and the response of the handler is replaced with a 413 response.
+// Likewise a corrupt body replaces the response with a 400 response.
+func Decompress(options DecompressOptions) Middleware {
+	if options.MaxRatio <= 0 {
+		options.MaxRatio = defaultMaxRatio
+	}
+	if options.OnError == nil {
+		options.OnError = defaultError
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == "identity" || r.Body == nil ||
+				r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			compressed := &countingReader{Reader: r.Body}
+			var (
+				reader io.ReadCloser
+				err    error
+			)
+			switch encoding {
+			case "gzip", "x-gzip":
+				reader, err = gzip.NewReader(compressed)
+			case "deflate":
+				reader, err = zlib.NewReader(compressed)
+			default:
+				options.OnError(w, r, http.StatusUnsupportedMediaType)
+				return
+			}
+			if err != nil {
+				options.OnError(w, r, http.StatusBadRequest)
+				return
+			}
+			guard := &bodyGuard{ResponseWriter: w, request: r}
+			r.Body = &decompressedBody{
+				reader:     reader,
+				original:   r.Body,
+				compressed: compressed,
+				guard:      guard,
+				options:    options,
+			}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			next.ServeHTTP(guard, r)
+			guard.finish()
+		})
+	}
+}
+
+// bodyGuard replaces the response of a handler with an error response when
+// reading the request body failed because of a limit.
+type bodyGuard struct {
+	http.ResponseWriter
+
+	request  *http.Request
+	status   int
+	onError  ErrorFunc
+	wrote    bool
+	discard  bool
+	hijacked bool
+}
+
+// fail records the error response to send instead of the handlers response.
+func (g *bodyGuard) fail(status int, onError ErrorFunc) {
+	if g.status == 0 {
+		g.status = status
+		g.onError = onError
+	}
+}
+
+// WriteHeader sends the error response if the body limit was exceeded.
+func (g *bodyGuard) WriteHeader(code int) {
+	if g.wrote {
+		return
+	}
+	g.wrote = true
+	if g.status != 0 {
+		g.discard = true
+		g.Header().Set("Connection", "close")
+		g.onError(g.ResponseWriter, g.request, g.status)
+		return
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+// finish sends the error response if the body limit was exceeded and the
+// handler returned without writing.
+func (g *bodyGuard) finish() {
+	if g.status != 0 && !g.wrote && !g.hijacked {
+		g.WriteHeader(g.status)
+	}
+}
+
+// Write discards the handlers response if the body limit was exceeded.
+func (g *bodyGuard) Write(b []byte) (int, error) {
+	if !g.wrote {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.discard {
+		return len(b), nil
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// Hijack takes over the connection, ex. for WebSocket. The error response is
+// not sent on a hijacked connection.
+func (g *bodyGuard) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(g.ResponseWriter).Hijack()
+	if err == nil {
+		g.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (g *bodyGuard) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// limitedBody is a request body that fails after limit bytes.
+type limitedBody struct {
+	io.ReadCloser
+
+	guard   *bodyGuard
+	limit   int64
+	length  int64
+	read    int64
+	onError ErrorFunc
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read > b.limit || b.length > b.limit {
+		b.guard.fail(http.StatusRequestEntityTooLarge, b.onError)
+		return 0, &http.MaxBytesError{Limit: b.limit}
+	}
+	if remaining := b.limit - b.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		b.guard.fail(http.StatusRequestEntityTooLarge, b.onError)
+		return n - int(b.read-b.limit), &http.MaxBytesError{Limit: b.limit}
+	}
+	return n, err
+}
+
+// decompressedBody is a request body that decompresses the original body
+// and fails when it expands beyond the configured limits.
+type decompressedBody struct {
+	reader     io.ReadCloser
+	original   io.Closer
+	compressed *countingReader
+	guard      *bodyGuard
+	options    DecompressOptions
+	read       int64
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	b.read += int64(n)
+	base := max(b.compressed.count, minRatioBase)
+	if b.read > base*b.options.MaxRatio ||
+		b.options.MaxSize > 0 && b.read > b.options.MaxSize {
+		b.guard.fail(http.StatusRequestEntityTooLarge, b.options.OnError)
+		return n, errDecompressionBomb
+	}
+	if corrupt(err) {
+		b.guard.fail(http.StatusBadRequest, b.options.OnError)
+	}
+	return n, err
+}
+
+// corrupt reports whether err is caused by invalid compressed data.
+func corrupt(err error) bool {
+	var flateErr flate.CorruptInputError
+	return errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) ||
+		errors.Is(err, zlib.ErrChecksum) || errors.Is(err, zlib.ErrHeader) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &flateErr)
+}
+
+func (b *decompressedBody) Close() error {
+	b.reader.Close()
+	return b.original.Close()
+}
+
+type countingReader struct {
+	io.Reader
+
+	count int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
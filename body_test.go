@@ -0,0 +1,164 @@
+package mux
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func echoBody(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write(body)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	router := NewRouter(MaxBodySize(8))
+	router.Post("/small", echoBody)
+	router.With(MaxBodySize(32)).Post("/large", echoBody)
+	custom := router.Group("/custom", BodyLimit(BodyLimitOptions{
+		Limit: 4,
+		OnError: func(w http.ResponseWriter, _ *http.Request, status int) {
+			w.WriteHeader(status)
+			io.WriteString(w, "custom too large")
+		},
+	}))
+	custom.Post("/echo", echoBody)
+	router.Post("/silent", func(_ http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		chunk  bool
+		status int
+		want   string
+	}{
+		{"withinLimit", "/small", "12345678", false, http.StatusOK, "12345678"},
+		{"contentLength", "/small", "123456789", false, http.StatusRequestEntityTooLarge,
+			"Request Entity Too Large\n"},
+		{"chunked", "/small", "123456789", true, http.StatusRequestEntityTooLarge,
+			"Request Entity Too Large\n"},
+		{"routeOverride", "/large", strings.Repeat("a", 32), false, http.StatusOK,
+			strings.Repeat("a", 32)},
+		{"groupRenderer", "/custom/echo", "12345", false, http.StatusRequestEntityTooLarge,
+			"custom too large"},
+		{"noWrite", "/silent", "123456789", true, http.StatusRequestEntityTooLarge,
+			"Request Entity Too Large\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunk {
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path, body)
+			if tt.chunk {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Error("expected", tt.status, "got", w.Code)
+			}
+			if w.Body.String() != tt.want {
+				t.Errorf("Expected '%s', got '%s'", tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	router := NewRouter(Decompress(DecompressOptions{MaxRatio: 10}))
+	router.Post("/echo", echoBody)
+
+	t.Run("gzip", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/echo",
+			bytes.NewReader(gzipped(t, []byte("hello compressed"))))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Body.String() != "hello compressed" {
+			t.Errorf("Expected 'hello compressed', got '%s'", w.Body.String())
+		}
+	})
+
+	t.Run("bomb", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/echo",
+			bytes.NewReader(gzipped(t, make([]byte, 1<<20))))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Error("expected", http.StatusRequestEntityTooLarge, "got", w.Code)
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		data := gzipped(t, []byte("hello compressed"))
+		for _, body := range [][]byte{[]byte("not gzip"), data[:len(data)-4]} {
+			req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader(body))
+			req.Header.Set("Content-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest || w.Body.String() != "Bad Request\n" {
+				t.Error("expected", http.StatusBadRequest, "got", w.Code, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("data"))
+		req.Header.Set("Content-Encoding", "br")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Error("expected", http.StatusUnsupportedMediaType, "got", w.Code)
+		}
+	})
+}
+
+func TestWith(t *testing.T) {
+	router := NewRouter()
+	tagged := router.With(makeMiddleware("Route"))
+	tagged.Get("/tagged", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Route"))
+	})
+	router.Get("/plain", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Route"))
+	})
+	for path, want := range map[string]string{"/tagged": "true", "/plain": ""} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Body.String() != want {
+			t.Errorf("%s: expected '%s', got '%s'", path, want, w.Body.String())
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/tagged", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Error("expected method not allowed, got", w.Code, w.Header().Get("Allow"))
+	}
+}
@@ -0,0 +1,116 @@
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// ErrMiddlewareNotFound is returned when a named middleware is not in the
+// chain of a router.
+var ErrMiddlewareNotFound = errors.New("middleware not found")
+
+// namedMiddleware is a middleware in the chain of a router.
+type namedMiddleware struct {
+	name       string
+	middleware Middleware
+}
+
+// UseNamed adds a middleware to the router under the given name, so that it
+// can be found with Middleware, InsertBefore, InsertAfter and Remove.
+// Middleware added with Use is named after its function, ex. mux.Logger.
+// It panics on a router returned by With.
+func (router *Router) UseNamed(name string, m Middleware) {
+	if m == nil {
+		panic("Router.Use: middleware cannot be nil")
+	}
+	router.mutable("Router.Use")
+	entry := namedMiddleware{name: name, middleware: m}
+	if router.ordered {
+		router.middleware = append(router.middleware, entry)
+	} else {
+		router.middleware = slices.Insert(router.middleware, 0, entry)
+	}
+	router.rebuild()
+}
+
+// Middleware returns the names of the middleware of the router in execution
+// order, the first name being the outermost middleware.
+func (router *Router) Middleware() []string {
+	names := make([]string, 0, len(router.middleware))
+	for _, entry := range router.middleware {
+		names = append(names, entry.name)
+	}
+	return names
+}
+
+// InsertBefore adds a middleware named name to the chain so that it runs
+// before the middleware named before, ex.
+// router.InsertBefore("auth", "ratelimit", mux.MaxConcurrent(100)) .
+// Names refer to the first middleware of that name in execution order.
+// InsertBefore, InsertAfter and Remove panic on a router returned by With.
+func (router *Router) InsertBefore(before, name string, m Middleware) error {
+	return router.insert(before, 0, name, m)
+}
+
+// InsertAfter adds a middleware named name to the chain so that it runs
+// after the middleware named after.
+func (router *Router) InsertAfter(after, name string, m Middleware) error {
+	return router.insert(after, 1, name, m)
+}
+
+// Remove removes the middleware named name from the chain.
+func (router *Router) Remove(name string) error {
+	router.mutable("Router.Remove")
+	i, err := router.find(name)
+	if err != nil {
+		return err
+	}
+	router.middleware = slices.Delete(router.middleware, i, i+1)
+	router.rebuild()
+	return nil
+}
+
+func (router *Router) insert(target string, offset int, name string, m Middleware) error {
+	if m == nil {
+		panic("Router.Insert: middleware cannot be nil")
+	}
+	router.mutable("Router.Insert")
+	i, err := router.find(target)
+	if err != nil {
+		return err
+	}
+	router.middleware = slices.Insert(router.middleware, i+offset,
+		namedMiddleware{name: name, middleware: m})
+	router.rebuild()
+	return nil
+}
+
+func (router *Router) find(name string) (int, error) {
+	i := slices.IndexFunc(router.middleware, func(entry namedMiddleware) bool {
+		return entry.name == name
+	})
+	if i < 0 {
+		return 0, fmt.Errorf("%w: %s", ErrMiddlewareNotFound, name)
+	}
+	return i, nil
+}
+
+// mutable panics if router was returned by With, which only applies its
+// middleware to the routes it registers and has no chain of its own.
+func (router *Router) mutable(method string) {
+	if router.base != nil {
+		panic(method + ": cannot change the middleware of a router returned by With")
+	}
+}
+
+// rebuild wraps the ServeMux of the router in its middleware, so that the
+// first middleware in execution order is the outermost.
+func (router *Router) rebuild() {
+	var chain http.Handler = router.ServeMux
+	for _, entry := range slices.Backward(router.middleware) {
+		chain = entry.middleware(chain)
+	}
+	router.chain = chain
+}
@@ -0,0 +1,154 @@
+package mux
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func tracer(trace *[]string, name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*trace = append(*trace, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func serveTrace(router *Router, path string, trace *[]string) []string {
+	*trace = nil
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	return *trace
+}
+
+func TestOrderedRouter(t *testing.T) {
+	var trace []string
+	router := NewOrderedRouter(tracer(&trace, "m1"), tracer(&trace, "m2"))
+	router.With(tracer(&trace, "i1"), tracer(&trace, "i2")).Get("/with",
+		func(http.ResponseWriter, *http.Request) { trace = append(trace, "handler") })
+	group := router.Group("/group", tracer(&trace, "g1"))
+	group.Use(tracer(&trace, "g2"))
+	group.Get("/", func(http.ResponseWriter, *http.Request) { trace = append(trace, "handler") })
+
+	want := []string{"m1", "m2", "i1", "i2", "handler"}
+	if got := serveTrace(router, "/with", &trace); !slices.Equal(got, want) {
+		t.Error("expected", want, "got", got)
+	}
+	want = []string{"m1", "m2", "g1", "g2", "handler"}
+	if got := serveTrace(router, "/group/", &trace); !slices.Equal(got, want) {
+		t.Error("expected", want, "got", got)
+	}
+}
+
+func TestNamedMiddleware(t *testing.T) {
+	var trace []string
+	router := NewRouter()
+	router.UseNamed("first", tracer(&trace, "first"))
+	router.UseNamed("second", tracer(&trace, "second"))
+	router.Get("/", func(http.ResponseWriter, *http.Request) { trace = append(trace, "handler") })
+
+	want := []string{"second", "first"}
+	if got := router.Middleware(); !slices.Equal(got, want) {
+		t.Error("expected", want, "got", got)
+	}
+	if err := router.InsertBefore("first", "before", tracer(&trace, "before")); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.InsertAfter("first", "after", tracer(&trace, "after")); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.Remove("second"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"before", "first", "after", "handler"}
+	if got := serveTrace(router, "/", &trace); !slices.Equal(got, want) {
+		t.Error("expected", want, "got", got)
+	}
+	if err := router.Remove("missing"); !errors.Is(err, ErrMiddlewareNotFound) {
+		t.Error("expected", ErrMiddlewareNotFound, "got", err)
+	}
+
+	router.Use(Logger)
+	if got := router.Middleware()[0]; got != "mux.Logger" {
+		t.Errorf("Expected 'mux.Logger', got '%s'", got)
+	}
+}
+
+func TestWithMiddlewarePanics(t *testing.T) {
+	with := NewRouter().With(Logger)
+	changes := map[string]func(){
+		"Use":          func() { with.Use(Logger) },
+		"UseNamed":     func() { with.UseNamed("logger", Logger) },
+		"InsertBefore": func() { with.InsertBefore("a", "b", Logger) },
+		"InsertAfter":  func() { with.InsertAfter("a", "b", Logger) },
+		"Remove":       func() { with.Remove("a") },
+	}
+	for name, change := range changes {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Expected panic from %s on With router", name)
+				}
+			}()
+			change()
+		}()
+	}
+}
+
+func TestGroupComposition(t *testing.T) {
+	var (
+		trace   []string
+		pattern string
+	)
+	handler := func(_ http.ResponseWriter, r *http.Request) {
+		trace = append(trace, "handler")
+		pattern = Pattern(r)
+	}
+	router := NewRouter()
+	api := router.Group("/api", tracer(&trace, "api"))
+	v1 := api.Group("/v1", tracer(&trace, "v1"))
+	v1.With(tracer(&trace, "with")).Get("/users", handler)
+	hooks := api.GroupWithOptions("/hooks", GroupOptions{Isolate: true}, tracer(&trace, "hooks"))
+	hooks.Post("/github", handler)
+	signed := hooks.Group("/signed", tracer(&trace, "signed"))
+	signed.Post("/{$}", handler)
+	inner := signed.GroupWithOptions("/inner", GroupOptions{Isolate: true})
+	inner.Post("/{$}", handler)
+
+	// middleware added after the routes still applies to them
+	router.Use(tracer(&trace, "root"))
+	api.Use(tracer(&trace, "api2"))
+
+	tests := []struct {
+		method, path string
+		want         []string
+	}{
+		{http.MethodGet, "/api/v1/users", []string{"root", "api2", "api", "v1", "with", "handler"}},
+		{http.MethodGet, "/api/v1/missing", []string{"root", "api2", "api", "v1"}},
+		{http.MethodPost, "/api/hooks/github", []string{"hooks", "handler"}},
+		{http.MethodPost, "/api/hooks/signed/", []string{"hooks", "signed", "handler"}},
+		{http.MethodPost, "/api/hooks/signed/inner/", []string{"handler"}},
+		{http.MethodGet, "/api/hooks/github", []string{"hooks"}},
+	}
+	for _, tt := range tests {
+		trace = nil
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+		if !slices.Equal(trace, tt.want) {
+			t.Error("expected", tt.want, "got", trace, tt.path)
+		}
+	}
+
+	patterns := map[string]string{
+		"/api/hooks/github":        "POST /api/hooks/github",
+		"/api/hooks/signed/":       "POST /api/hooks/signed/{$}",
+		"/api/hooks/signed/inner/": "POST /api/hooks/signed/inner/{$}",
+	}
+	for path, want := range patterns {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+		if pattern != want {
+			t.Errorf("Expected '%s', got '%s'", want, pattern)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package mux
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Constraint reports whether a path value is valid.
+type Constraint func(value string) bool
+
+var (
+	constraintsMu sync.RWMutex
+	constraints   = map[string]Constraint{
+		"int":   isInt,
+		"uint":  isUint,
+		"uuid":  isUUID,
+		"alpha": isAlpha,
+		"alnum": isAlnum,
+	}
+)
+
+// RegisterConstraint registers a named constraint for path wildcards. The
+// built in constraints are:
+//
+//	{id:int}                 an integer
+//	{id:uint}                a non-negative integer
+//	{id:uuid}                a UUID such as 0f8fad5b-d9cb-469f-a165-70867728950e
+//	{name:alpha}             letters
+//	{name:alnum}             letters and digits
+//	{kind:enum(book|film)}   one of the listed values
+//	{year:regex(\d{4})}      a match of the whole value with the expression
+//
+// Registered constraints are used by name, ex.
+// mux.RegisterConstraint("slug", isSlug) and router.Get("/posts/{slug:slug}", post) .
+func RegisterConstraint(name string, constraint Constraint) {
+	if constraint == nil {
+		panic("mux.RegisterConstraint: constraint cannot be nil")
+	}
+	constraintsMu.Lock()
+	defer constraintsMu.Unlock()
+	constraints[name] = constraint
+}
+
+// parseConstraints removes the constraints from the wildcards of pattern,
+// ex. "/articles/{id:int}" becomes "/articles/{id}".
+func parseConstraints(pattern string) (string, map[string]Constraint) {
+	var (
+		clean  strings.Builder
+		checks map[string]Constraint
+	)
+	for {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			clean.WriteString(pattern)
+			return clean.String(), checks
+		}
+		end := wildcardEnd(pattern, start)
+		if end < 0 {
+			clean.WriteString(pattern)
+			return clean.String(), checks
+		}
+		clean.WriteString(pattern[:start])
+		name, spec, found := strings.Cut(pattern[start+1:end], ":")
+		clean.WriteString("{" + name + "}")
+		if found {
+			if checks == nil {
+				checks = map[string]Constraint{}
+			}
+			checks[strings.TrimSuffix(name, "...")] = compileConstraint(spec)
+		}
+		pattern = pattern[end+1:]
+	}
+}
+
+// wildcardEnd returns the index of the brace closing the wildcard starting
+// at start, skipping braces within the parentheses of a constraint.
+func wildcardEnd(pattern string, start int) int {
+	depth := 0
+	for i := start + 1; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '}':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func compileConstraint(spec string) Constraint {
+	name, arg, hasArg := strings.Cut(spec, "(")
+	if hasArg {
+		arg = strings.TrimSuffix(arg, ")")
+		switch name {
+		case "enum":
+			values := strings.Split(arg, "|")
+			return func(value string) bool {
+				return slices.Contains(values, value)
+			}
+		case "regex":
+			re := regexp.MustCompile("^(?:" + arg + ")$")
+			return re.MatchString
+		}
+	}
+	constraintsMu.RLock()
+	defer constraintsMu.RUnlock()
+	constraint, ok := constraints[spec]
+	if !ok {
+		panic(fmt.Sprintf("mux: unknown path constraint %q", spec))
+	}
+	return constraint
+}
+
+// checkConstraints wraps handler to respond not found when a path value does
+// not satisfy its constraint.
+func (router *Router) checkConstraints(checks map[string]Constraint,
+	handler http.Handler,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, check := range checks {
+			if !check(r.PathValue(name)) {
+				router.notFoundHandler()(w, r)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func isInt(value string) bool {
+	_, err := strconv.ParseInt(value, 10, 64)
+	return err == nil
+}
+
+func isUint(value string) bool {
+	_, err := strconv.ParseUint(value, 10, 64)
+	return err == nil
+}
+
+func isUUID(value string) bool {
+	if len(value) != 36 {
+		return false
+	}
+	for i, r := range value {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if r != '-' {
+				return false
+			}
+		} else if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(value string) bool {
+	return value != "" && !strings.ContainsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+func isAlnum(value string) bool {
+	return value != "" && !strings.ContainsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// PathInt returns the path value name as an int. An invalid value is an
+// HTTPError with status 404 Not Found, so error returning handlers can
+// return it, ex.
+// id, err := mux.PathInt(r, "id") .
+func PathInt(r *http.Request, name string) (int, error) {
+	n, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		return 0, pathError(name, err)
+	}
+	return n, nil
+}
+
+// PathInt64 returns the path value name as an int64, see PathInt.
+func PathInt64(r *http.Request, name string) (int64, error) {
+	n, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil {
+		return 0, pathError(name, err)
+	}
+	return n, nil
+}
+
+// PathUint64 returns the path value name as an uint64, see PathInt.
+func PathUint64(r *http.Request, name string) (uint64, error) {
+	n, err := strconv.ParseUint(r.PathValue(name), 10, 64)
+	if err != nil {
+		return 0, pathError(name, err)
+	}
+	return n, nil
+}
+
+func pathError(name string, err error) error {
+	return &HTTPError{
+		Status: http.StatusNotFound,
+		Err:    fmt.Errorf("path value %s: %w", name, err),
+	}
+}
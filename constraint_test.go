@@ -0,0 +1,105 @@
+package mux
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPathConstraints(t *testing.T) {
+	RegisterConstraint("slug", func(value string) bool {
+		return value != "" && !strings.ContainsFunc(value, func(r rune) bool {
+			return (r < 'a' || r > 'z') && r != '-'
+		})
+	})
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.PathValue("v"))
+	}
+	router := NewRouter()
+	router.Get("/int/{v:int}", echo)
+	router.Get("/uuid/{v:uuid}", echo)
+	router.Get("/enum/{v:enum(book|film)}", echo)
+	router.Get("/year/{v:regex(\\d{4})}", echo)
+	router.Get("/slug/{v:slug}", echo)
+	router.Get("/files/{v:alnum}/{rest...}", echo)
+	api := router.Group("/api")
+	api.NotFound(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "api not found")
+	})
+	api.Get("/users/{v:uint}", echo)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/int/-42", http.StatusOK, "-42"},
+		{"/int/abc", http.StatusNotFound, "404 page not found\n"},
+		{"/uuid/0f8fad5b-d9cb-469f-a165-70867728950e", http.StatusOK,
+			"0f8fad5b-d9cb-469f-a165-70867728950e"},
+		{"/uuid/0f8fad5b", http.StatusNotFound, "404 page not found\n"},
+		{"/enum/film", http.StatusOK, "film"},
+		{"/enum/song", http.StatusNotFound, "404 page not found\n"},
+		{"/year/2024", http.StatusOK, "2024"},
+		{"/year/20245", http.StatusNotFound, "404 page not found\n"},
+		{"/slug/hello-world", http.StatusOK, "hello-world"},
+		{"/slug/Hello", http.StatusNotFound, "404 page not found\n"},
+		{"/files/abc1/a/b", http.StatusOK, "abc1"},
+		{"/api/users/7", http.StatusOK, "7"},
+		{"/api/users/-7", http.StatusNotFound, "api not found"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Error("expected", tt.status, tt.body, "got", w.Code, w.Body.String(), tt.path)
+		}
+	}
+	if routes := router.Routes(); routes[0] != "GET /int/{v:int}" {
+		t.Errorf("Expected 'GET /int/{v:int}', got '%s'", routes[0])
+	}
+}
+
+func TestUnknownConstraintPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for unknown constraint")
+		}
+	}()
+	NewRouter().Get("/{id:unknown}", func(http.ResponseWriter, *http.Request) {})
+}
+
+func TestPathInt(t *testing.T) {
+	router := NewRouter()
+	router.GetE("/items/{id}", func(w http.ResponseWriter, r *http.Request) error {
+		id, err := PathInt(r, "id")
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "item "+strconv.Itoa(id))
+		return err
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/5", nil))
+	if w.Body.String() != "item 5" {
+		t.Errorf("Expected 'item 5', got '%s'", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/five", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error("expected", http.StatusNotFound, "got", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetPathValue("id", "x")
+	_, err := PathUint64(req, "id")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Status != http.StatusNotFound {
+		t.Error("expected", http.StatusNotFound, "got", err)
+	}
+}
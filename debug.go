@@ -0,0 +1,148 @@
+package mux
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+var processStart = time.Now()
+
+var debugEndpoints = []string{
+	"pprof/", "vars", "routes", "middleware", "build", "runtime",
+}
+
+// Debug mounts a group of debug endpoints at prefix, protected by the given
+// middlewares:
+//
+//	pprof/      the pprof profiles, ex. go tool pprof http://host/debug/pprof/heap
+//	vars        the expvar variables
+//	routes      the full patterns of the routes of the router
+//	middleware  the middleware chains of the router and its groups
+//	build       the build information of the binary
+//	runtime     goroutine count, memory and Go runtime information
+//
+// The endpoints expose internals of the application and should only be
+// reachable by operators, ex. on an admin listener or behind authentication:
+// router.Debug("/debug", adminOnly) .
+// The group is isolated, so that middleware of the router such as Timeout
+// or BodyLimit does not cut off long running profiles and traces; only the
+// given middlewares apply.
+func (router *Router) Debug(prefix string, middlewares ...Middleware) *Router {
+	root := router.root()
+	group := router.GroupWithOptions(prefix, GroupOptions{Isolate: true}, middlewares...)
+	group.Get("/{$}", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, strings.Join(debugEndpoints, "\n"))
+	})
+	group.Get("/pprof/{$}", pprof.Index)
+	group.Get("/pprof/cmdline", pprof.Cmdline)
+	group.Get("/pprof/profile", pprof.Profile)
+	group.Get("/pprof/symbol", pprof.Symbol)
+	group.Post("/pprof/symbol", pprof.Symbol)
+	group.Get("/pprof/trace", pprof.Trace)
+	group.Get("/pprof/{profile}", func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(r.PathValue("profile")).ServeHTTP(w, r)
+	})
+	group.Get("/vars", expvar.Handler().ServeHTTP)
+	group.Get("/routes", func(w http.ResponseWriter, _ *http.Request) {
+		writeDebug(w, root.Routes())
+	})
+	group.Get("/middleware", func(w http.ResponseWriter, _ *http.Request) {
+		writeDebug(w, root.middlewareChains(""))
+	})
+	group.Get("/build", func(w http.ResponseWriter, _ *http.Request) {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			http.Error(w, "build information not available", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, info.String())
+	})
+	group.Get("/runtime", func(w http.ResponseWriter, _ *http.Request) {
+		writeDebug(w, runtimeInfo())
+	})
+	return group
+}
+
+// middlewareChain lists the middleware of a router in execution order.
+type middlewareChain struct {
+	Prefix     string   `json:"prefix"`
+	Middleware []string `json:"middleware"`
+}
+
+func (router *Router) middlewareChains(prefix string) []middlewareChain {
+	router = router.registry()
+	chains := []middlewareChain{{Prefix: prefix, Middleware: router.Middleware()}}
+	for _, group := range router.groups {
+		chains = append(chains, group.middlewareChains(prefix+group.prefix)...)
+	}
+	return chains
+}
+
+// middlewareName returns the function name of a middleware, ex. mux.Logger,
+// or mux.Timeout.func1 for middleware returned by a constructor.
+func middlewareName(m Middleware) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(m).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
+
+type memoryInfo struct {
+	Alloc      uint64 `json:"alloc"`
+	TotalAlloc uint64 `json:"totalAlloc"`
+	Sys        uint64 `json:"sys"`
+	HeapInuse  uint64 `json:"heapInuse"`
+	NumGC      uint32 `json:"numGC"`
+}
+
+type runtimeStats struct {
+	GoVersion  string     `json:"goVersion"`
+	GOOS       string     `json:"goos"`
+	GOARCH     string     `json:"goarch"`
+	NumCPU     int        `json:"numCPU"`
+	GOMAXPROCS int        `json:"gomaxprocs"`
+	Goroutines int        `json:"goroutines"`
+	Uptime     string     `json:"uptime"`
+	Memory     memoryInfo `json:"memory"`
+}
+
+func runtimeInfo() runtimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return runtimeStats{
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		Uptime:     time.Since(processStart).Round(time.Second).String(),
+		Memory: memoryInfo{
+			Alloc:      mem.Alloc,
+			TotalAlloc: mem.TotalAlloc,
+			Sys:        mem.Sys,
+			HeapInuse:  mem.HeapInuse,
+			NumGC:      mem.NumGC,
+		},
+	}
+}
+
+func writeDebug(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
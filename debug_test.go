@@ -0,0 +1,91 @@
+package mux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	router := NewRouter()
+	router.Get("/{$}", func(http.ResponseWriter, *http.Request) {})
+	router.With(Logger).Post("/login", func(http.ResponseWriter, *http.Request) {})
+	api := router.Group("/api")
+	api.Get("/users/{id}", func(http.ResponseWriter, *http.Request) {})
+	api.Group("/v2").HandleFunc("/items", func(http.ResponseWriter, *http.Request) {})
+
+	want := []string{"GET /{$}", "POST /login", "GET /api/users/{id}", "/api/v2/items"}
+	if got := router.Routes(); !slices.Equal(got, want) {
+		t.Error("expected", want, "got", got)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	denied := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Admin") == "" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	rootMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Root", "yes")
+			next.ServeHTTP(w, r)
+		})
+	}
+	router := NewRouter(Logger, rootMiddleware)
+	router.Get("/hello", func(http.ResponseWriter, *http.Request) {})
+	router.Debug("/debug", denied)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Admin", "yes")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+	if w.Code != http.StatusForbidden {
+		t.Error("expected", http.StatusForbidden, "got", w.Code)
+	}
+
+	var routes []string
+	json.NewDecoder(get("/debug/routes").Body).Decode(&routes)
+	if !slices.Contains(routes, "GET /hello") || !slices.Contains(routes, "GET /debug/vars") {
+		t.Error("expected debug and application routes, got", routes)
+	}
+
+	var chains []middlewareChain
+	json.NewDecoder(get("/debug/middleware").Body).Decode(&chains)
+	if len(chains) != 2 || len(chains[0].Middleware) != 2 ||
+		chains[1].Prefix != "/debug" || len(chains[1].Middleware) != 1 {
+		t.Error("expected root and debug chains, got", chains)
+	}
+
+	var stats runtimeStats
+	json.NewDecoder(get("/debug/runtime").Body).Decode(&stats)
+	if stats.Goroutines == 0 || stats.GoVersion == "" {
+		t.Error("expected runtime information, got", stats)
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine", "/debug/vars"} {
+		if w := get(path); w.Code != http.StatusOK {
+			t.Error("expected", http.StatusOK, "got", w.Code, path)
+		}
+	}
+	if body := get("/debug/pprof/").Body.String(); !strings.Contains(body, "heap") {
+		t.Errorf("Expected pprof index, got '%s'", body)
+	}
+	// middleware of the router, such as Timeout, does not cut off profiles
+	if w := get("/debug/vars"); w.Header().Get("X-Root") != "" {
+		t.Error("expected debug group isolated from router middleware")
+	}
+}
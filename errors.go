@@ -0,0 +1,355 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"maps"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Problem is an RFC 9457 problem details object. It implements error, so
+// handlers can pass it to Error to respond with a specific status.
+type Problem struct {
+	// Type is a URI identifying the problem type. Defaults to about:blank.
+	Type string
+	// Title is a short summary of the problem type. Defaults to the status
+	// text.
+	Title string
+	// Status is the HTTP status code.
+	Status int
+	// Detail explains this occurrence of the problem to the client.
+	Detail string
+	// Instance is a URI identifying this occurrence of the problem.
+	Instance string
+	// Extensions are additional members of the problem object.
+	Extensions map[string]any
+}
+
+// NewProblem returns a problem with the given status and detail.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Status: status, Title: http.StatusText(status), Detail: detail}
+}
+
+// Error returns the detail of the problem, or the title if there is none.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// MarshalJSON encodes the problem as an application/problem+json object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	object := make(map[string]any, len(p.Extensions)+5)
+	maps.Copy(object, p.Extensions)
+	object["type"] = p.Type
+	if p.Type == "" {
+		object["type"] = "about:blank"
+	}
+	object["title"] = p.Title
+	object["status"] = p.Status
+	if p.Detail != "" {
+		object["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		object["instance"] = p.Instance
+	}
+	return json.Marshal(object)
+}
+
+// StatusError is implemented by errors that map to an HTTP status code.
+// The message of errors with a 4xx status is sent to the client; errors
+// with a 5xx status are only logged.
+type StatusError interface {
+	error
+	StatusCode() int
+}
+
+// ProblemFor converts an error to a problem. Errors that are not a Problem,
+// an HTTPError, a ValidationError or a StatusError are internal server
+// errors. The fields of a ValidationError are listed in the errors member.
+// A missing or invalid Status is replaced with 500 and a missing Title with
+// the status text; a Problem passed in err is copied before it is changed.
+func ProblemFor(err error) *Problem {
+	problem := problemFor(err)
+	if problem.Status < 100 || problem.Status > 599 || problem.Title == "" {
+		normalized := *problem
+		if normalized.Status < 100 || normalized.Status > 599 {
+			normalized.Status = http.StatusInternalServerError
+		}
+		if normalized.Title == "" {
+			normalized.Title = http.StatusText(normalized.Status)
+		}
+		problem = &normalized
+	}
+	return problem
+}
+
+func problemFor(err error) *Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return problem
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		problem := NewProblem(validationErr.Status, validationErr.Error())
+		problem.Extensions = map[string]any{"errors": validationErr.Errors}
+		return problem
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return NewProblem(httpErr.Status, httpErr.Message)
+	}
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		status := statusErr.StatusCode()
+		if status >= http.StatusInternalServerError {
+			return NewProblem(status, "")
+		}
+		return NewProblem(status, statusErr.Error())
+	}
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+// ErrorRenderer writes error responses for a router, see Router.RenderErrors.
+type ErrorRenderer interface {
+	RenderError(w http.ResponseWriter, r *http.Request, problem *Problem)
+}
+
+// ErrorRendererFunc is a function implementing ErrorRenderer.
+type ErrorRendererFunc func(w http.ResponseWriter, r *http.Request, problem *Problem)
+
+// RenderError calls f.
+func (f ErrorRendererFunc) RenderError(w http.ResponseWriter, r *http.Request,
+	problem *Problem,
+) {
+	f(w, r, problem)
+}
+
+// DefaultProblemTemplate is the template used for HTML error pages when
+// ProblemRenderer.HTML is nil.
+var DefaultProblemTemplate = template.Must(template.New("problem").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.Title}}</title>
+</head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+{{if .Detail}}<p>{{.Detail}}</p>{{end}}
+</body>
+</html>
+`))
+
+// ProblemRenderer renders errors according to the Accept header of the
+// request as application/problem+json, HTML or plain text.
+type ProblemRenderer struct {
+	// HTML is executed with the Problem for clients accepting text/html.
+	// Defaults to DefaultProblemTemplate.
+	HTML *template.Template
+}
+
+// RenderError writes the problem in the format preferred by the client.
+func (p ProblemRenderer) RenderError(w http.ResponseWriter, r *http.Request, problem *Problem) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Add("Vary", "Accept")
+	switch Negotiate(r, "application/problem+json", "application/json", "text/html",
+		"text/plain") {
+	case "application/problem+json", "application/json":
+		body, err := json.Marshal(problem)
+		if err != nil {
+			break
+		}
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(problem.Status)
+		w.Write(append(body, '\n'))
+		return
+	case "text/html":
+		tmpl := p.HTML
+		if tmpl == nil {
+			tmpl = DefaultProblemTemplate
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, problem); err != nil {
+			slog.Error("ProblemRenderer: failed to render error page", "error", err)
+			break
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(problem.Status)
+		w.Write(buf.Bytes())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(problem.Status)
+	w.Write([]byte(problem.Error() + "\n"))
+}
+
+// RenderErrors sets the renderer for errors of the router: not found and
+// method not allowed responses without a custom handler, errors of the
+// middleware of this package without an OnError function, and errors passed
+// to Error. Groups use the renderer of their parent unless they set their
+// own, ex.
+// router.RenderErrors(mux.ProblemRenderer{HTML: errorPage}) .
+func (router *Router) RenderErrors(renderer ErrorRenderer) *Router {
+	router.registry().renderer = renderer
+	router.root().rendering = true
+	return router
+}
+
+type renderKey struct{}
+
+// renderScope holds the error renderer, templates and error handler of the
+// innermost router serving a request, so that middleware of outer routers
+// renders errors like the route, Render finds the templates of the route and
+// helpers like JSON handle errors like the HandlerFuncE routes.
+//
+// Scopes are not changed once published: each router level stores a new
+// scope in the renderHolder of the request, so that middleware reading the
+// scope concurrently, such as Timeout, does not race with inner routers.
+type renderScope struct {
+	renderer  ErrorRenderer
+	templates *Templates
+	onError   ErrorHandler
+}
+
+// renderHolder is the context value holding the current render scope.
+type renderHolder struct {
+	scope atomic.Pointer[renderScope]
+}
+
+// renderScope returns r with the renderer and templates of the router in
+// its render scope.
+func (router *Router) renderScope(r *http.Request) *http.Request {
+	holder, ok := r.Context().Value(renderKey{}).(*renderHolder)
+	if !ok {
+		if router.renderer == nil && router.views == nil && !router.rendering {
+			return r
+		}
+		holder = &renderHolder{}
+		holder.scope.Store(&renderScope{})
+		r = r.WithContext(context.WithValue(r.Context(), renderKey{}, holder))
+	}
+	if router.renderer == nil && router.views == nil && router.onError == nil {
+		return r
+	}
+	scope := *holder.scope.Load()
+	if router.renderer != nil {
+		scope.renderer = router.renderer
+	}
+	if router.views != nil {
+		scope.templates = router.views
+	}
+	if router.onError != nil {
+		scope.onError = router.onError
+	}
+	holder.scope.Store(&scope)
+	return r
+}
+
+// currentScope returns the render scope of r, or an empty scope.
+func currentScope(r *http.Request) *renderScope {
+	if holder, ok := r.Context().Value(renderKey{}).(*renderHolder); ok {
+		return holder.scope.Load()
+	}
+	return &renderScope{}
+}
+
+// Error writes an error response for err using the error renderer of the
+// router serving the request, ex.
+// mux.Error(w, r, mux.NewProblem(http.StatusConflict, "user exists")) .
+// Without a renderer the response is plain text like http.Error.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	problem := ProblemFor(err)
+	if problem.Status >= http.StatusInternalServerError {
+		slog.Error("mux.Error: internal error", "method", r.Method, "path", r.URL.Path,
+			"error", err)
+	}
+	renderProblem(w, r, problem)
+}
+
+func renderProblem(w http.ResponseWriter, r *http.Request, problem *Problem) {
+	if scope := currentScope(r); scope.renderer != nil {
+		scope.renderer.RenderError(w, r, problem)
+		return
+	}
+	http.Error(w, problem.Error(), problem.Status)
+}
+
+// defaultError renders an error with the given status for middleware
+// without an OnError function.
+func defaultError(w http.ResponseWriter, r *http.Request, status int) {
+	renderProblem(w, r, NewProblem(status, ""))
+}
+
+func defaultNotFound(w http.ResponseWriter, r *http.Request) {
+	if scope := currentScope(r); scope.renderer != nil {
+		scope.renderer.RenderError(w, r, NewProblem(http.StatusNotFound, ""))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func defaultNotAllowed(w http.ResponseWriter, r *http.Request, _ []string) {
+	defaultError(w, r, http.StatusMethodNotAllowed)
+}
+
+// Recover is a middleware that recovers from panics in handlers, logs them
+// with the stack trace and responds with an internal server error unless
+// the response was already started. http.ErrAbortHandler is not recovered.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			slog.Error("mux.Recover: panic serving request", "method", r.Method,
+				"path", r.URL.Path, "panic", recovered, "stack", string(debug.Stack()))
+			if !rw.wrote {
+				defaultError(w, r, http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// trackingWriter records whether the response was started.
+type trackingWriter struct {
+	http.ResponseWriter
+
+	wrote bool
+}
+
+// WriteHeader records that the response was started.
+func (rw *trackingWriter) WriteHeader(code int) {
+	rw.wrote = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write records that the response was started.
+func (rw *trackingWriter) Write(b []byte) (int, error) {
+	rw.wrote = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush records that the response was started.
+func (rw *trackingWriter) Flush() {
+	rw.wrote = true
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (rw *trackingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
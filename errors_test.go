@@ -0,0 +1,141 @@
+package mux
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type conflictError struct{}
+
+func (conflictError) Error() string   { return "user exists" }
+func (conflictError) StatusCode() int { return http.StatusConflict }
+
+func TestRenderErrors(t *testing.T) {
+	router := NewRouter(Recover, MaxBodySize(4))
+	router.RenderErrors(ProblemRenderer{})
+	router.Get("/panic", func(http.ResponseWriter, *http.Request) { panic("boom") })
+	router.Get("/conflict", func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, conflictError{})
+	})
+	router.Get("/internal", func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, errors.New("database password is hunter2"))
+	})
+	api := router.Group("/api")
+	api.RenderErrors(ErrorRendererFunc(func(w http.ResponseWriter, _ *http.Request, p *Problem) {
+		w.WriteHeader(p.Status)
+		io.WriteString(w, "api: "+p.Title)
+	}))
+	api.Post("/upload", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+
+	tests := []struct {
+		method, path, accept string
+		status               int
+		contentType, body    string
+	}{
+		{http.MethodGet, "/missing", "application/json", http.StatusNotFound,
+			"application/problem+json", `"title":"Not Found"`},
+		{http.MethodGet, "/missing", "text/html", http.StatusNotFound,
+			"text/html; charset=utf-8", "<h1>404 Not Found</h1>"},
+		{http.MethodGet, "/missing", "text/plain", http.StatusNotFound,
+			"text/plain; charset=utf-8", "Not Found\n"},
+		{http.MethodPost, "/panic", "", http.StatusMethodNotAllowed,
+			"application/problem+json", `"status":405`},
+		{http.MethodGet, "/panic", "", http.StatusInternalServerError,
+			"application/problem+json", `"type":"about:blank"`},
+		{http.MethodGet, "/conflict", "", http.StatusConflict,
+			"application/problem+json", `"detail":"user exists"`},
+		{http.MethodGet, "/api/missing", "", http.StatusNotFound, "", "api: Not Found"},
+		{http.MethodPost, "/api/upload", "", http.StatusRequestEntityTooLarge, "",
+			"api: Request Entity Too Large"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("too large"))
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Error("expected", tt.status, "got", w.Code, tt.path)
+		}
+		if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("Expected '%s', got '%s'", tt.contentType, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("Expected '%s' in body, got '%s'", tt.body, w.Body.String())
+		}
+		if tt.contentType != "" && w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Expected 'Accept', got '%s'", w.Header().Get("Vary"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal", nil))
+	var problem map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := problem["detail"]; ok || problem["status"] != float64(500) {
+		t.Error("expected internal error without detail, got", problem)
+	}
+}
+
+func TestErrorWithoutRenderer(t *testing.T) {
+	router := NewRouter()
+	router.Get("/problem", func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, NewProblem(http.StatusTeapot, "short and stout"))
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/problem", nil))
+	if w.Code != http.StatusTeapot || w.Body.String() != "short and stout\n" {
+		t.Error("expected", http.StatusTeapot, "short and stout", "got", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Body.String() != "404 page not found\n" {
+		t.Errorf("Expected '404 page not found', got '%s'", w.Body.String())
+	}
+}
+
+func TestProblemForNormalizes(t *testing.T) {
+	original := &Problem{Detail: "no status"}
+	problem := ProblemFor(original)
+	if problem.Status != http.StatusInternalServerError ||
+		problem.Title != "Internal Server Error" {
+		t.Error("expected", http.StatusInternalServerError, "got", problem.Status, problem.Title)
+	}
+	if original.Status != 0 || original.Title != "" {
+		t.Error("expected original problem unchanged, got", original)
+	}
+	problem = ProblemFor(&HTTPError{Status: 1000})
+	if problem.Status != http.StatusInternalServerError {
+		t.Error("expected", http.StatusInternalServerError, "got", problem.Status)
+	}
+	problem = ProblemFor(&Problem{Status: http.StatusTeapot})
+	if problem.Title != "I'm a teapot" {
+		t.Errorf("Expected 'I'm a teapot', got '%s'", problem.Title)
+	}
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	handler := Recover(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Error("expected", http.ErrAbortHandler, "got", recovered)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
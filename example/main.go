@@ -4,8 +4,8 @@ package main
 import (
 	"io"
 	"log"
+	"net"
 	"net/http"
-	"net/http/pprof"
 
 	"github.com/devilcove/mux"
 )
@@ -22,7 +22,7 @@ func main() {
 	router.Static("/pages/", "static")
 	router.Static("/world", "static")
 	router.ServeFile("/junk.txt", "static/hello.txt")
-	router.Get("/debug/", pprof.Profile)
+	router.Debug("/debug", localOnly)
 	// router.All("/", notFound)
 
 	group1 := router.Group("/extra")
@@ -73,6 +73,19 @@ func empty(next http.Handler) http.Handler {
 	})
 }
 
+// localOnly hides the debug endpoints from clients that are not on the
+// loopback interface.
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func notFound(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 	io.WriteString(w, "<!DOCTYPE html><div style=\"font-family: 'Bush Script MT', cursive;"+
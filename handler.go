@@ -0,0 +1,145 @@
+package mux
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// HandlerFuncE is a handler that returns an error instead of writing error
+// responses itself, ex.
+//
+//	router.GetE("/users/{id}", func(w http.ResponseWriter, r *http.Request) error {
+//		user, err := db.User(r.Context(), r.PathValue("id"))
+//		if err != nil {
+//			return &mux.HTTPError{Status: http.StatusNotFound, Message: "no such user", Err: err}
+//		}
+//		return json.NewEncoder(w).Encode(user)
+//	})
+type HandlerFuncE func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP calls h and writes returned errors with Error.
+func (h HandlerFuncE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveE(w, r, h, Error)
+}
+
+// ErrorHandler handles the errors returned by a HandlerFuncE.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// HTTPError is an error with a status code and a message for the client.
+// The cause is only logged, ex.
+// return &mux.HTTPError{Status: http.StatusBadGateway, Message: "payment failed", Err: err} .
+type HTTPError struct {
+	// Status is the HTTP status code of the response.
+	Status int
+	// Message is sent to the client. Defaults to the status text.
+	Message string
+	// Err is the internal cause of the error.
+	Err error
+}
+
+// Error returns the message and the cause of the error.
+func (e *HTTPError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.Status)
+	}
+	if e.Err != nil {
+		return message + ": " + e.Err.Error()
+	}
+	return message
+}
+
+// Unwrap returns the cause of the error.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the status of the error.
+func (e *HTTPError) StatusCode() int {
+	return e.Status
+}
+
+// HandleErrors sets the handler for errors returned by the HandlerFuncE
+// routes and the JSON handlers of the router. Groups use the handler of
+// their parent unless they set their own. Defaults to Error, which renders
+// the error with the error renderer of the router.
+func (router *Router) HandleErrors(h ErrorHandler) *Router {
+	router.registry().onError = h
+	router.root().rendering = true
+	return router
+}
+
+// errorHandler returns the error handler of the router or of the closest
+// parent that has one.
+func (router *Router) errorHandler() ErrorHandler {
+	for router = router.registry(); router != nil; router = router.parent {
+		if router.onError != nil {
+			return router.onError
+		}
+	}
+	return Error
+}
+
+// handleError passes err to the error handler of the router serving r, see
+// HandleErrors.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if scope := currentScope(r); scope.onError != nil {
+		scope.onError(w, r, err)
+		return
+	}
+	Error(w, r, err)
+}
+
+// HandleE registers the error returning handler for the given pattern.
+func (router *Router) HandleE(pattern string, handler HandlerFuncE) {
+	router.HandleFunc(pattern, router.adaptE(handler))
+}
+
+// GetE registers the error returning handler for get requests on given pattern.
+func (router *Router) GetE(pattern string, handler HandlerFuncE) {
+	router.Get(pattern, router.adaptE(handler))
+}
+
+// PostE registers the error returning handler for post requests on given pattern.
+func (router *Router) PostE(pattern string, handler HandlerFuncE) {
+	router.Post(pattern, router.adaptE(handler))
+}
+
+// PutE registers the error returning handler for put requests on given pattern.
+func (router *Router) PutE(pattern string, handler HandlerFuncE) {
+	router.Put(pattern, router.adaptE(handler))
+}
+
+// PatchE registers the error returning handler for patch requests on given pattern.
+func (router *Router) PatchE(pattern string, handler HandlerFuncE) {
+	router.Patch(pattern, router.adaptE(handler))
+}
+
+// DeleteE registers the error returning handler for delete requests on given pattern.
+func (router *Router) DeleteE(pattern string, handler HandlerFuncE) {
+	router.Delete(pattern, router.adaptE(handler))
+}
+
+// adaptE converts an error returning handler to a http.HandlerFunc using the
+// error handler of the router.
+func (router *Router) adaptE(handler HandlerFuncE) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveE(w, r, handler, router.errorHandler())
+	}
+}
+
+// serveE calls handler and passes a returned error to onError, unless the
+// handler already started the response, in which case the error is logged.
+func serveE(w http.ResponseWriter, r *http.Request, handler HandlerFuncE, onError ErrorHandler) {
+	tw := &trackingWriter{ResponseWriter: w}
+	err := handler(tw, r)
+	if err == nil {
+		return
+	}
+	if tw.wrote {
+		slog.Error("mux: handler failed after writing the response", "method", r.Method,
+			"path", r.URL.Path, "error", err)
+		return
+	}
+	onError(w, r, err)
+}
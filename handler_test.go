@@ -0,0 +1,90 @@
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerFuncE(t *testing.T) {
+	errNoRows := errors.New("sql: no rows in result set")
+	router := NewRouter()
+	router.GetE("/users/{id}", func(w http.ResponseWriter, r *http.Request) error {
+		if r.PathValue("id") != "1" {
+			return fmt.Errorf("loading user: %w", &HTTPError{
+				Status: http.StatusNotFound, Message: "no such user", Err: errNoRows,
+			})
+		}
+		_, err := io.WriteString(w, "alice")
+		return err
+	})
+	router.PostE("/fail", func(http.ResponseWriter, *http.Request) error {
+		return errors.New("connection reset")
+	})
+	router.PutE("/partial", func(w http.ResponseWriter, _ *http.Request) error {
+		io.WriteString(w, "partial")
+		return errors.New("write interrupted")
+	})
+	api := router.Group("/api")
+	api.DeleteE("/items/{id}", func(http.ResponseWriter, *http.Request) error {
+		return &HTTPError{Status: http.StatusForbidden}
+	})
+	// error handlers set after registration apply to the routes of groups
+	router.HandleErrors(func(w http.ResponseWriter, r *http.Request, err error) {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.Status == http.StatusForbidden {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "custom forbidden")
+			return
+		}
+		Error(w, r, err)
+	})
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{http.MethodGet, "/users/1", http.StatusOK, "alice"},
+		{http.MethodGet, "/users/2", http.StatusNotFound, "no such user\n"},
+		{http.MethodPost, "/fail", http.StatusInternalServerError, "Internal Server Error\n"},
+		{http.MethodPut, "/partial", http.StatusOK, "partial"},
+		{http.MethodDelete, "/api/items/1", http.StatusForbidden, "custom forbidden"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Error("expected", tt.status, tt.body, "got", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	cause := errors.New("timeout")
+	err := fmt.Errorf("charge: %w",
+		&HTTPError{Status: http.StatusBadGateway, Message: "payment failed", Err: cause})
+	if !errors.Is(err, cause) {
+		t.Error("expected cause to be unwrapped")
+	}
+	if err.Error() != "charge: payment failed: timeout" {
+		t.Errorf("Expected 'charge: payment failed: timeout', got '%s'", err.Error())
+	}
+	problem := ProblemFor(err)
+	if problem.Status != http.StatusBadGateway || problem.Detail != "payment failed" {
+		t.Error("expected", http.StatusBadGateway, "payment failed", "got", problem.Status,
+			problem.Detail)
+	}
+
+	w := httptest.NewRecorder()
+	HandlerFuncE(func(http.ResponseWriter, *http.Request) error {
+		return err
+	}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusBadGateway || strings.Contains(w.Body.String(), "timeout") {
+		t.Error("expected", http.StatusBadGateway, "without cause, got", w.Code, w.Body.String())
+	}
+}
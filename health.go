@@ -0,0 +1,217 @@
+package mux
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultCheckTimeout = 2 * time.Second
+
+// Health check and report states.
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthFailed   = "failed"
+	HealthDraining = "draining"
+)
+
+// HealthCheck is a named check of a dependency of the application.
+type HealthCheck struct {
+	// Name identifies the check in reports.
+	Name string
+	// Check returns an error if the dependency is unhealthy.
+	Check func(ctx context.Context) error
+	// Timeout limits the time Check may take. Defaults to 2 seconds.
+	Timeout time.Duration
+	// Cache reuses the result of Check for the given duration, so that
+	// frequent probes do not overload the dependency.
+	Cache time.Duration
+	// Critical checks fail readiness. Failing non critical checks only
+	// degrade the report.
+	Critical bool
+	// Liveness includes the check in liveness probes. Liveness checks should
+	// only fail when restarting the process is the remedy.
+	Liveness bool
+}
+
+// HealthOptions configures Router.HealthWithOptions.
+type HealthOptions struct {
+	// DrainDelay is the time Shutdown waits after failing readiness before
+	// the server stops accepting requests. It should exceed the probe
+	// interval of the load balancer.
+	DrainDelay time.Duration
+}
+
+// CheckResult is the result of a HealthCheck.
+type CheckResult struct {
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Duration string    `json:"duration"`
+	Checked  time.Time `json:"checked"`
+	Critical bool      `json:"critical"`
+}
+
+// HealthReport is the JSON body of health responses.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health is a registry of health checks.
+type Health struct {
+	router *Router
+
+	mu     sync.Mutex
+	checks []*healthCheck
+}
+
+type healthCheck struct {
+	HealthCheck
+
+	mu     sync.Mutex
+	result CheckResult
+	expiry time.Time
+}
+
+// Health registers health endpoints backed by a registry of checks:
+// pattern and pattern/ready report readiness, pattern/live reports
+// liveness. Responses are JSON reports with status 200, or 503 when a
+// critical check fails or the router is draining after Shutdown, ex.
+// router.Health("/healthz").Add(mux.HealthCheck{Name: "db", Check: db.PingContext}) .
+func (router *Router) Health(pattern string) *Health {
+	return router.HealthWithOptions(pattern, HealthOptions{})
+}
+
+// HealthWithOptions registers health endpoints like Health.
+func (router *Router) HealthWithOptions(pattern string, options HealthOptions) *Health {
+	health := &Health{router: router}
+	root := router.root()
+	root.drainDelay = max(root.drainDelay, options.DrainDelay)
+	router.Get(pattern, health.Ready)
+	router.Get(pattern+"/ready", health.Ready)
+	router.Get(pattern+"/live", health.Live)
+	return health
+}
+
+// Add registers a check.
+func (h *Health) Add(check HealthCheck) *Health {
+	if check.Timeout <= 0 {
+		check.Timeout = defaultCheckTimeout
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, &healthCheck{HealthCheck: check})
+	return h
+}
+
+// Ready is the readiness handler. It runs all checks and fails while the
+// router is draining.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context(), false)
+	if h.router.Draining() {
+		report.Status = HealthDraining
+	}
+	writeHealth(w, report)
+}
+
+// Live is the liveness handler. It only runs liveness checks and keeps
+// succeeding while the router is draining.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, h.Check(r.Context(), true))
+}
+
+// Check runs the registered checks concurrently, or only the liveness
+// checks if liveness is set, and returns the report.
+func (h *Health) Check(ctx context.Context, liveness bool) HealthReport {
+	h.mu.Lock()
+	checks := make([]*healthCheck, 0, len(h.checks))
+	for _, check := range h.checks {
+		if !liveness || check.Liveness {
+			checks = append(checks, check)
+		}
+	}
+	h.mu.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = check.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthOK, Checks: map[string]CheckResult{}}
+	for i, check := range checks {
+		report.Checks[check.Name] = results[i]
+		if results[i].Status == HealthOK {
+			continue
+		}
+		if check.Critical || liveness {
+			report.Status = HealthFailed
+		} else if report.Status == HealthOK {
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+// run returns the cached result or runs the check. The check runs with its
+// own timeout, detached from ctx, so that a caller giving up early fails
+// only its own report and does not fill the cache with its error.
+func (c *healthCheck) run(ctx context.Context) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Before(c.expiry) {
+		return c.result
+	}
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.Timeout)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Check(checkCtx)
+	}()
+	var err error
+	select {
+	case err = <-errs:
+	case <-checkCtx.Done():
+		err = checkCtx.Err()
+	case <-ctx.Done():
+		return CheckResult{
+			Status:   HealthFailed,
+			Error:    ctx.Err().Error(),
+			Duration: time.Since(now).String(),
+			Checked:  now,
+			Critical: c.Critical,
+		}
+	}
+	c.result = CheckResult{
+		Status:   HealthOK,
+		Duration: time.Since(now).String(),
+		Checked:  now,
+		Critical: c.Critical,
+	}
+	if err != nil {
+		c.result.Status = HealthFailed
+		c.result.Error = err.Error()
+	}
+	c.expiry = now.Add(c.Cache)
+	return c.result
+}
+
+func writeHealth(w http.ResponseWriter, report HealthReport) {
+	status := http.StatusOK
+	if report.Status == HealthFailed || report.Status == HealthDraining {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
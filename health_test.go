@@ -0,0 +1,133 @@
+package mux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func getHealth(t *testing.T, router *Router, path string) (int, HealthReport) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var report HealthReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, report
+}
+
+func TestHealth(t *testing.T) {
+	router := NewRouter()
+	var dbDown atomic.Bool
+	health := router.Health("/healthz")
+	health.Add(HealthCheck{Name: "db", Critical: true, Check: func(context.Context) error {
+		if dbDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}})
+	health.Add(HealthCheck{Name: "cache", Check: func(context.Context) error {
+		return errors.New("cache unavailable")
+	}})
+	health.Add(HealthCheck{Name: "process", Liveness: true, Check: func(context.Context) error {
+		return nil
+	}})
+
+	code, report := getHealth(t, router, "/healthz/ready")
+	if code != http.StatusOK || report.Status != HealthDegraded {
+		t.Error("expected", http.StatusOK, HealthDegraded, "got", code, report.Status)
+	}
+	if report.Checks["cache"].Error != "cache unavailable" {
+		t.Errorf("Expected 'cache unavailable', got '%s'", report.Checks["cache"].Error)
+	}
+
+	dbDown.Store(true)
+	code, report = getHealth(t, router, "/healthz")
+	if code != http.StatusServiceUnavailable || report.Status != HealthFailed {
+		t.Error("expected", http.StatusServiceUnavailable, HealthFailed, "got", code, report.Status)
+	}
+
+	code, report = getHealth(t, router, "/healthz/live")
+	if code != http.StatusOK || report.Status != HealthOK || len(report.Checks) != 1 {
+		t.Error("expected", http.StatusOK, HealthOK, 1, "got", code, report.Status,
+			len(report.Checks))
+	}
+}
+
+func TestHealthCheckTimeoutAndCache(t *testing.T) {
+	router := NewRouter()
+	var calls atomic.Int32
+	router.Health("/healthz").Add(HealthCheck{
+		Name:     "slow",
+		Critical: true,
+		Timeout:  10 * time.Millisecond,
+		Cache:    time.Minute,
+		Check: func(ctx context.Context) error {
+			calls.Add(1)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	for range 3 {
+		code, report := getHealth(t, router, "/healthz")
+		if code != http.StatusServiceUnavailable {
+			t.Error("expected", http.StatusServiceUnavailable, "got", code)
+		}
+		if report.Checks["slow"].Error != context.DeadlineExceeded.Error() {
+			t.Errorf("Expected '%s', got '%s'", context.DeadlineExceeded,
+				report.Checks["slow"].Error)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Error("expected", 1, "got", calls.Load())
+	}
+}
+
+func TestHealthCallerCancelled(t *testing.T) {
+	health := NewRouter().Health("/healthz")
+	health.Add(HealthCheck{
+		Name:  "db",
+		Cache: time.Minute,
+		Check: func(ctx context.Context) error {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if report := health.Check(ctx, false); report.Status != HealthDegraded {
+		t.Error("expected", HealthDegraded, "got", report.Status)
+	}
+	report := health.Check(context.Background(), false)
+	if report.Status != HealthOK || report.Checks["db"].Error != "" {
+		t.Error("expected", HealthOK, "got", report.Status, report.Checks["db"].Error)
+	}
+}
+
+func TestHealthDraining(t *testing.T) {
+	router := NewRouter()
+	api := router.Group("/api")
+	api.Health("/healthz")
+	if err := router.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	code, report := getHealth(t, router, "/api/healthz/ready")
+	if code != http.StatusServiceUnavailable || report.Status != HealthDraining {
+		t.Error("expected", http.StatusServiceUnavailable, HealthDraining, "got", code,
+			report.Status)
+	}
+	code, _ = getHealth(t, router, "/api/healthz/live")
+	if code != http.StatusOK {
+		t.Error("expected", http.StatusOK, "got", code)
+	}
+}
@@ -0,0 +1,169 @@
+package mux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const defaultJSONBodySize = 1 << 20
+
+// JSONOptions configures JSONWithOptions.
+type JSONOptions struct {
+	// MaxBodySize is the maximum size of the request body in bytes.
+	// Defaults to 1MiB.
+	MaxBodySize int64
+	// Status is the status of successful responses. Defaults to 200 OK.
+	Status int
+}
+
+// JSON adapts a typed function to a handler. The request body is decoded
+// into Req, rejecting unknown fields, then fields tagged with path, query,
+// header and cookie are set like Bind, and the request is validated with
+// Validate. The result of fn is encoded as JSON; errors are passed to the
+// error handler of the router, see HandleErrors, which defaults to Error, so
+// binding errors respond 400 Bad Request and validation errors 422
+// Unprocessable Entity with the invalid fields, ex.
+//
+//	type getUser struct {
+//		ID     int    `path:"id" validate:"min=1"`
+//		Fields string `query:"fields"`
+//	}
+//	router.Get("/users/{id}", mux.JSON(func(ctx context.Context, req getUser) (User, error) {
+//		return db.User(ctx, req.ID)
+//	}))
+func JSON[Req, Resp any](fn func(context.Context, Req) (Resp, error)) http.HandlerFunc {
+	return JSONWithOptions(JSONOptions{}, fn)
+}
+
+// JSONWithOptions adapts a typed function to a handler like JSON.
+func JSONWithOptions[Req, Resp any](options JSONOptions,
+	fn func(context.Context, Req) (Resp, error),
+) http.HandlerFunc {
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = defaultJSONBodySize
+	}
+	if options.Status == 0 {
+		options.Status = http.StatusOK
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := decodeJSON(w, r, &req, options.MaxBodySize); err != nil {
+			handleError(w, r, err)
+			return
+		}
+		if errs := bindStruct(r, &req); len(errs) > 0 {
+			handleError(w, r, &ValidationError{Status: http.StatusBadRequest, Errors: errs})
+			return
+		}
+		if err := Validate(&req); err != nil {
+			handleError(w, r, err)
+			return
+		}
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			handleError(w, r, err)
+			return
+		}
+		body, err := json.Marshal(resp)
+		if err != nil {
+			handleError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(options.Status)
+		w.Write(append(body, '\n'))
+	}
+}
+
+// bindStruct binds the fields of the struct dst points to, except form
+// fields, from the request.
+func bindStruct(r *http.Request, dst any) []FieldError {
+	v := reflect.ValueOf(dst).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	return bindRequest(r, v, "path", "query", "header", "cookie")
+}
+
+// decodeJSON decodes a JSON request body into dst. An empty body leaves dst
+// unchanged.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any, limit int64) error {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil ||
+			(mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+			return &HTTPError{
+				Status:  http.StatusUnsupportedMediaType,
+				Message: "Content-Type must be application/json",
+			}
+		}
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+	if err == nil {
+		if decoder.Decode(&struct{}{}) != io.EOF {
+			return &HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: "body must contain a single JSON value",
+			}
+		}
+		return nil
+	}
+	var (
+		maxBytes  *http.MaxBytesError
+		syntax    *json.SyntaxError
+		typeError *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil
+	case errors.As(err, &maxBytes):
+		return &HTTPError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: "body exceeds " + strconv.FormatInt(maxBytes.Limit, 10) + " bytes",
+			Err:     err,
+		}
+	case errors.As(err, &syntax), errors.Is(err, io.ErrUnexpectedEOF):
+		return &HTTPError{Status: http.StatusBadRequest, Message: "invalid JSON", Err: err}
+	case errors.As(err, &typeError):
+		return &ValidationError{Status: http.StatusBadRequest, Errors: []FieldError{{
+			Field: typeError.Field, Message: "must be " + jsonKind(typeError.Type.Kind().String()),
+		}}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return &ValidationError{Status: http.StatusBadRequest, Errors: []FieldError{{
+			Field: field, Message: "is not allowed",
+		}}}
+	default:
+		return &HTTPError{Status: http.StatusBadRequest, Message: "invalid JSON", Err: err}
+	}
+}
+
+// jsonKind describes a Go kind in JSON terms.
+func jsonKind(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "an integer"
+	case strings.HasPrefix(kind, "float"):
+		return "a number"
+	case kind == "bool":
+		return "a boolean"
+	case kind == "string":
+		return "a string"
+	case kind == "slice", kind == "array":
+		return "an array"
+	default:
+		return "an object"
+	}
+}
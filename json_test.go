@@ -0,0 +1,144 @@
+package mux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createItem struct {
+	Owner  string   `path:"owner"`
+	DryRun bool     `query:"dry_run"`
+	Name   string   `json:"name" validate:"required,max=8"`
+	Kind   string   `json:"kind" validate:"oneof=book film"`
+	Price  float64  `json:"price" validate:"min=0"`
+	Tags   []string `json:"tags" validate:"max=2"`
+	Email  string   `json:"email" validate:"email"`
+}
+
+type item struct {
+	Owner  string `json:"owner"`
+	Name   string `json:"name"`
+	DryRun bool   `json:"dryRun"`
+}
+
+func TestJSON(t *testing.T) {
+	router := NewRouter()
+	router.RenderErrors(ProblemRenderer{})
+	router.Post("/users/{owner}/items", JSONWithOptions(JSONOptions{
+		MaxBodySize: 256, Status: http.StatusCreated,
+	}, func(_ context.Context, req createItem) (item, error) {
+		if req.Name == "taken" {
+			return item{}, &HTTPError{Status: http.StatusConflict, Message: "name taken"}
+		}
+		return item{Owner: req.Owner, Name: req.Name, DryRun: req.DryRun}, nil
+	}))
+
+	tests := []struct {
+		path, contentType, body string
+		status                  int
+		want                    string
+	}{
+		{"/users/ann/items?dry_run=true", "application/json", `{"name":"pen","kind":"book"}`,
+			http.StatusCreated, `{"owner":"ann","name":"pen","dryRun":true}`},
+		{"/users/ann/items", "text/plain", `{"name":"pen"}`,
+			http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"/users/ann/items", "", `{"name":"pen","colour":"red"}`,
+			http.StatusBadRequest, `{"field":"colour","message":"is not allowed"}`},
+		{"/users/ann/items", "", `{"name":`, http.StatusBadRequest, "invalid JSON"},
+		{"/users/ann/items", "", `{"name":"a"} {}`, http.StatusBadRequest, "single JSON value"},
+		{"/users/ann/items", "", `{"name":1}`, http.StatusBadRequest, "must be a string"},
+		{"/users/ann/items?dry_run=maybe", "", `{"name":"pen"}`,
+			http.StatusBadRequest, `{"field":"dry_run","message":"must be a boolean"}`},
+		{"/users/ann/items", "", `{"name":"` + strings.Repeat("a", 300) + `"}`,
+			http.StatusRequestEntityTooLarge, "body exceeds 256 bytes"},
+		{"/users/ann/items", "", `{"name":"taken"}`, http.StatusConflict, "name taken"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.want) {
+			t.Error("expected", tt.status, tt.want, "got", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestJSONValidation(t *testing.T) {
+	router := NewRouter()
+	router.Post("/items", JSON(func(_ context.Context, req createItem) (item, error) {
+		return item{Name: req.Name}, nil
+	}))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(
+		`{"kind":"song","price":-1,"tags":["a","b","c"],"email":"nobody"}`)))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Error("expected", http.StatusUnprocessableEntity, "got", w.Code)
+	}
+	want := "name: is required; kind: must be one of book, film; price: must be at least 0; " +
+		"tags: must have at most 2 elements; email: must be an email address\n"
+	if w.Body.String() != want {
+		t.Errorf("Expected '%s', got '%s'", want, w.Body.String())
+	}
+}
+
+func TestJSONHandleErrors(t *testing.T) {
+	var handled []error
+	router := NewRouter()
+	api := router.Group("/api")
+	api.HandleErrors(func(w http.ResponseWriter, _ *http.Request, err error) {
+		handled = append(handled, err)
+		w.WriteHeader(http.StatusTeapot)
+	})
+	api.Post("/items", JSON(func(_ context.Context, req createItem) (item, error) {
+		return item{}, errors.New("store failed")
+	}))
+	for _, body := range []string{`{"name":`, `{"kind":"song"}`, `{"name":"pen","kind":"book"}`} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/items",
+			strings.NewReader(body)))
+		if w.Code != http.StatusTeapot {
+			t.Error("expected", http.StatusTeapot, "got", w.Code, body)
+		}
+	}
+	if len(handled) != 3 || handled[2].Error() != "store failed" {
+		t.Error("expected 3 errors passed to the error handler, got", handled)
+	}
+}
+
+type signup struct {
+	Password string `json:"password" validate:"min=8"`
+	Confirm  string `json:"confirm"`
+	Address  struct {
+		City string `json:"city" validate:"required"`
+	} `json:"address"`
+}
+
+func (s *signup) Validate() error {
+	if s.Password != s.Confirm {
+		return &ValidationError{Errors: []FieldError{{Field: "confirm", Message: "must match"}}}
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	err := Validate(&signup{Password: "secret", Confirm: "other"})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatal("expected ValidationError, got", err)
+	}
+	got, _ := json.Marshal(validationErr.Errors)
+	want := `[{"field":"password","message":"must have at least 8 characters"},` +
+		`{"field":"address.city","message":"is required"},` +
+		`{"field":"confirm","message":"must match"}]`
+	if string(got) != want {
+		t.Errorf("Expected '%s', got '%s'", want, got)
+	}
+}
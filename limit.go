@@ -0,0 +1,198 @@
+package mux
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxWait    = time.Second
+	defaultRetryAfter = time.Second
+	defaultLatency    = 100 * time.Millisecond
+	// decreaseFactor is applied to the adaptive limit when the latency of
+	// a request exceeds the target.
+	decreaseFactor = 0.9
+)
+
+// Priority classifies requests for ConcurrencyLimit.
+type Priority int
+
+const (
+	// PriorityNormal requests wait in the queue when the limit is reached.
+	PriorityNormal Priority = iota
+	// PriorityLow requests are shed immediately when the limit is reached.
+	PriorityLow
+	// PriorityCritical requests, such as health checks, are never shed and
+	// do not count against the limit.
+	PriorityCritical
+)
+
+// LimitOptions configures ConcurrencyLimit.
+type LimitOptions struct {
+	// MaxInFlight is the maximum number of requests served concurrently.
+	// It must be positive.
+	MaxInFlight int
+	// MaxQueue is the maximum number of requests waiting for a slot.
+	MaxQueue int
+	// MaxWait is the maximum time a request waits in the queue.
+	// Defaults to one second.
+	MaxWait time.Duration
+	// RetryAfter is sent in the Retry-After header of shed requests.
+	// Defaults to one second.
+	RetryAfter time.Duration
+	// Priority classifies requests. All requests are PriorityNormal when nil.
+	Priority func(*http.Request) Priority
+	// Adaptive adjusts the limit between MinInFlight and MaxInFlight based
+	// on observed latency: the limit shrinks when requests are slower than
+	// TargetLatency and grows while they are faster.
+	Adaptive bool
+	// MinInFlight is the lower bound of the adaptive limit. Defaults to 1.
+	MinInFlight int
+	// TargetLatency is the latency the adaptive limit aims for.
+	// Defaults to 100 milliseconds.
+	TargetLatency time.Duration
+	// OnError renders the 503 Service Unavailable response of shed requests.
+	// Defaults to the error renderer of the router, see Router.RenderErrors.
+	OnError ErrorFunc
+}
+
+// MaxConcurrent is a middleware that serves at most n requests concurrently
+// and sheds the rest. It panics if n is not positive. See ConcurrencyLimit.
+func MaxConcurrent(n int) Middleware {
+	return ConcurrencyLimit(LimitOptions{MaxInFlight: n})
+}
+
+// ConcurrencyLimit is a middleware that caps the number of in-flight
+// requests. Requests over the limit wait in a bounded queue for up to
+// MaxWait; the rest are shed with 503 Service Unavailable and a Retry-After
+// header. Each call creates an independent limit, so a router and each
+// Group may have their own, ex.
+// router.Group("/api", mux.MaxConcurrent(100)) .
+// It panics if MaxInFlight is not positive.
+func ConcurrencyLimit(options LimitOptions) Middleware {
+	limit := newLimiter(options)
+	options = limit.options
+	retryAfter := strconv.Itoa(int(math.Ceil(options.RetryAfter.Seconds())))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			priority := PriorityNormal
+			if options.Priority != nil {
+				priority = options.Priority(r)
+			}
+			if priority == PriorityCritical {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !limit.acquire(r, priority) {
+				w.Header().Set("Retry-After", retryAfter)
+				options.OnError(w, r, http.StatusServiceUnavailable)
+				return
+			}
+			start := time.Now()
+			defer func() {
+				limit.release(time.Since(start))
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// newLimiter validates options and applies the defaults.
+func newLimiter(options LimitOptions) *limiter {
+	if options.MaxInFlight <= 0 {
+		panic("mux.ConcurrencyLimit: MaxInFlight must be positive")
+	}
+	if options.MaxWait <= 0 {
+		options.MaxWait = defaultMaxWait
+	}
+	if options.RetryAfter <= 0 {
+		options.RetryAfter = defaultRetryAfter
+	}
+	options.MinInFlight = min(max(options.MinInFlight, 1), options.MaxInFlight)
+	if options.Adaptive && options.TargetLatency <= 0 {
+		options.TargetLatency = defaultLatency
+	}
+	if options.OnError == nil {
+		options.OnError = defaultError
+	}
+	return &limiter{options: options, limit: float64(options.MaxInFlight)}
+}
+
+// limiter hands out slots to requests in FIFO order.
+type limiter struct {
+	options LimitOptions
+
+	mu       sync.Mutex
+	inFlight int
+	limit    float64
+	queue    []*waiter
+}
+
+// acquire reports whether the request got a slot, waiting in the queue if
+// allowed by its priority.
+func (l *limiter) acquire(r *http.Request, priority Priority) bool {
+	l.mu.Lock()
+	if l.inFlight < l.current() {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	if priority == PriorityLow || len(l.queue) >= l.options.MaxQueue {
+		l.mu.Unlock()
+		return false
+	}
+	wait := &waiter{ready: make(chan struct{})}
+	l.queue = append(l.queue, wait)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.options.MaxWait)
+	defer timer.Stop()
+	select {
+	case <-wait.ready:
+		return true
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if wait.granted {
+		return true
+	}
+	l.queue = slices.DeleteFunc(l.queue, func(w *waiter) bool { return w == wait })
+	return false
+}
+
+// release returns a slot, adjusts an adaptive limit with the latency of the
+// request and hands free slots to waiting requests.
+func (l *limiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if l.options.Adaptive {
+		if latency > l.options.TargetLatency {
+			l.limit = max(float64(l.options.MinInFlight), l.limit*decreaseFactor)
+		} else {
+			l.limit = min(float64(l.options.MaxInFlight), l.limit+1/l.limit)
+		}
+	}
+	for len(l.queue) > 0 && l.inFlight < l.current() {
+		wait := l.queue[0]
+		l.queue = l.queue[1:]
+		wait.granted = true
+		close(wait.ready)
+		l.inFlight++
+	}
+}
+
+func (l *limiter) current() int {
+	return int(l.limit)
+}
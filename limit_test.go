@@ -0,0 +1,117 @@
+package mux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	router := NewRouter(ConcurrencyLimit(LimitOptions{
+		MaxInFlight: 1,
+		MaxQueue:    1,
+		MaxWait:     time.Second,
+		RetryAfter:  2 * time.Second,
+		Priority: func(r *http.Request) Priority {
+			switch {
+			case r.URL.Path == "/healthz":
+				return PriorityCritical
+			case strings.HasPrefix(r.URL.Path, "/batch"):
+				return PriorityLow
+			}
+			return PriorityNormal
+		},
+	}))
+	router.Get("/block", func(_ http.ResponseWriter, _ *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	router.Get("/healthz", dummyHandler)
+	router.Get("/batch", dummyHandler)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	var wg sync.WaitGroup
+	results := make(chan int, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- serve("/block").Code
+		}()
+	}
+	<-started
+	// wait for the second request to be queued
+	time.Sleep(20 * time.Millisecond)
+
+	if w := serve("/block"); w.Code != http.StatusServiceUnavailable ||
+		w.Header().Get("Retry-After") != "2" {
+		t.Error("expected shed request, got", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := serve("/batch"); w.Code != http.StatusServiceUnavailable {
+		t.Error("expected low priority request to be shed, got", w.Code)
+	}
+	if w := serve("/healthz"); w.Code != http.StatusOK {
+		t.Error("expected critical request to be served, got", w.Code)
+	}
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+	wg.Wait()
+	close(results)
+	for code := range results {
+		if code != http.StatusOK {
+			t.Error("expected queued requests to be served, got", code)
+		}
+	}
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	l := &limiter{
+		options: LimitOptions{
+			MaxInFlight:   10,
+			MinInFlight:   2,
+			Adaptive:      true,
+			TargetLatency: 10 * time.Millisecond,
+		},
+		limit: 10,
+	}
+	for range 20 {
+		l.inFlight++
+		l.release(time.Second)
+	}
+	if l.current() != 2 {
+		t.Error("expected limit to shrink to 2, got", l.current())
+	}
+	for range 20 {
+		l.inFlight++
+		l.release(time.Millisecond)
+	}
+	if l.current() <= 2 {
+		t.Error("expected limit to grow, got", l.current())
+	}
+}
+
+func TestLimitOptions(t *testing.T) {
+	l := newLimiter(LimitOptions{MaxInFlight: 4, MinInFlight: 8, Adaptive: true})
+	if l.options.TargetLatency != defaultLatency {
+		t.Error("expected", defaultLatency, "got", l.options.TargetLatency)
+	}
+	if l.options.MinInFlight != 4 {
+		t.Error("expected", 4, "got", l.options.MinInFlight)
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for MaxInFlight 0")
+		}
+	}()
+	MaxConcurrent(0)
+}
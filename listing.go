@@ -0,0 +1,198 @@
+package mux
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Listing is the data passed to the directory listing template and encoded
+// for JSON listings.
+type Listing struct {
+	Path        string         `json:"path"`
+	Sort        string         `json:"sort"`
+	Order       string         `json:"order"`
+	Breadcrumbs []Breadcrumb   `json:"breadcrumbs"`
+	Entries     []ListingEntry `json:"entries"`
+}
+
+// Breadcrumb links to a parent directory of a listing.
+type Breadcrumb struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ListingEntry describes a file or directory of a listing.
+type ListingEntry struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	IsDir   bool      `json:"isDir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// DefaultListingTemplate is the template used for directory listings when
+// StaticOptions.Browse is set without a ListingTemplate.
+var DefaultListingTemplate = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"size": formatSize,
+	"sortURL": func(listing Listing, column string) string {
+		order := "asc"
+		if listing.Sort == column && listing.Order == "asc" {
+			order = "desc"
+		}
+		return "?sort=" + column + "&order=" + order
+	},
+}).Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>Index of {{.Path}}</title>
+<style>
+body{font-family:sans-serif;margin:2em}
+table{border-collapse:collapse}
+th,td{padding:.2em 1em;text-align:left}
+td.size{text-align:right}
+</style>
+</head>
+<body>
+<h1>{{range .Breadcrumbs}}<a href="{{.URL}}">{{.Name}}</a>{{end}}</h1>
+<table>
+<tr>
+<th><a href="{{sortURL . "name"}}">Name</a></th>
+<th><a href="{{sortURL . "size"}}">Size</a></th>
+<th><a href="{{sortURL . "time"}}">Modified</a></th>
+</tr>
+{{- range .Entries}}
+<tr>
+<td><a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td>
+<td class="size">{{if not .IsDir}}{{size .Size}}{{end}}</td>
+<td>{{.ModTime.Format "2006-01-02 15:04:05"}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// serveListing renders a directory listing as HTML or, when requested by
+// the Accept header, as JSON. The listing is sorted with the sort (name,
+// size or time) and order (asc or desc) query parameters.
+func (s *staticHandler) serveListing(w http.ResponseWriter, r *http.Request, name string,
+	entries []fs.FileInfo,
+) {
+	listing := newListing(name, entries, r.URL.Query().Get("sort"), r.URL.Query().Get("order"))
+	w.Header().Add("Vary", "Accept")
+	if Negotiate(r, "text/html", "application/json") == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(listing); err != nil {
+			s.serveError(w, r, err)
+		}
+		return
+	}
+	tmpl := s.options.ListingTemplate
+	if tmpl == nil {
+		tmpl = DefaultListingTemplate
+	}
+	// render into a buffer so template errors do not produce a partial page
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, listing); err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func newListing(name string, infos []fs.FileInfo, sortBy, order string) Listing {
+	if !slices.Contains([]string{"name", "size", "time"}, sortBy) {
+		sortBy = "name"
+	}
+	if order != "desc" {
+		order = "asc"
+	}
+	dir := strings.TrimSuffix(name, "/") + "/"
+	listing := Listing{
+		Path:        dir,
+		Sort:        sortBy,
+		Order:       order,
+		Breadcrumbs: breadcrumbs(dir),
+		Entries:     make([]ListingEntry, 0, len(infos)),
+	}
+	for _, info := range infos {
+		link := url.URL{Path: info.Name()}
+		entry := ListingEntry{
+			Name:    info.Name(),
+			URL:     link.String(),
+			IsDir:   info.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if entry.IsDir {
+			entry.URL += "/"
+			entry.Size = 0
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+	slices.SortStableFunc(listing.Entries, func(a, b ListingEntry) int {
+		if a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+		var result int
+		switch sortBy {
+		case "size":
+			result = cmp.Compare(a.Size, b.Size)
+		case "time":
+			result = a.ModTime.Compare(b.ModTime)
+		}
+		if result == 0 {
+			result = strings.Compare(a.Name, b.Name)
+		}
+		if order == "desc" {
+			return -result
+		}
+		return result
+	})
+	return listing
+}
+
+// breadcrumbs links every parent of dir with relative URLs, so that
+// listings work when mounted in a Group.
+func breadcrumbs(dir string) []Breadcrumb {
+	parts := strings.Split(strings.Trim(dir, "/"), "/")
+	if parts[0] == "" {
+		parts = nil
+	}
+	crumbs := []Breadcrumb{{Name: "/", URL: "./" + strings.Repeat("../", len(parts))}}
+	for i, part := range parts {
+		crumbs = append(crumbs, Breadcrumb{
+			Name: part + "/",
+			URL:  "./" + strings.Repeat("../", len(parts)-1-i),
+		})
+	}
+	return crumbs
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,90 @@
+package mux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStaticBrowse(t *testing.T) {
+	now := time.Now()
+	files := fstest.MapFS{
+		"docs/small.txt": {Data: []byte("a"), ModTime: now},
+		"docs/large.txt": {Data: []byte(strings.Repeat("a", 2048)), ModTime: now.Add(-time.Hour)},
+		"docs/.hidden":   {Data: []byte("hidden")},
+		"docs/sub/x.txt": {Data: []byte("x")},
+	}
+	router := NewRouter()
+	router.StaticFS("/files", files, StaticOptions{Browse: true, HideDotfiles: true})
+
+	t.Run("html", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/files/docs/", nil)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		body := w.Body.String()
+		for _, want := range []string{
+			`<a href="large.txt">large.txt</a>`, "2.0 KiB", `<a href="./../">/</a>`,
+			`<a href="sub/">sub/</a>`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected '%s' in listing, got '%s'", want, body)
+			}
+		}
+		if strings.Contains(body, ".hidden") {
+			t.Error("dotfile listed", body)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/files/docs/?sort=size&order=desc", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Header().Get("Content-Type") != "application/json" {
+			t.Error("wrong content type", w.Header().Get("Content-Type"))
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Expected 'Accept', got '%s'", w.Header().Get("Vary"))
+		}
+		var listing Listing
+		if err := json.NewDecoder(w.Body).Decode(&listing); err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, entry := range listing.Entries {
+			names = append(names, entry.Name)
+		}
+		if strings.Join(names, ",") != "sub,large.txt,small.txt" {
+			t.Error("wrong order", names)
+		}
+		if listing.Path != "/docs/" || len(listing.Breadcrumbs) != 2 {
+			t.Error("wrong listing", listing.Path, listing.Breadcrumbs)
+		}
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "text/html"},
+		{"application/json", "application/json"},
+		{"text/*;q=0.5, application/json", "application/json"},
+		{"text/html;q=0.9, application/*;q=0.9", "text/html"},
+		{"*/*", "text/html"},
+		{"image/png", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := Negotiate(req, "text/html", "application/json"); got != tt.want {
+			t.Errorf("Accept '%s': expected '%s', got '%s'", tt.accept, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package mux
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDurationBuckets are the latency histogram buckets in seconds.
+var DefaultDurationBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// DefaultSizeBuckets are the response size histogram buckets in bytes.
+var DefaultSizeBuckets = []float64{
+	100, 1000, 10_000, 100_000, 1_000_000, 10_000_000,
+}
+
+// MetricsOptions configures NewMetrics.
+type MetricsOptions struct {
+	// DurationBuckets are the upper bounds of the latency histogram in
+	// seconds. Defaults to DefaultDurationBuckets.
+	DurationBuckets []float64
+	// SizeBuckets are the upper bounds of the response size histogram in
+	// bytes. Defaults to DefaultSizeBuckets.
+	SizeBuckets []float64
+}
+
+// Metrics records request metrics and renders them in the Prometheus text
+// exposition format. Requests are labelled by method, route pattern and
+// status. The route is the full pattern of the matched route, see Pattern,
+// so the number of series is bounded by the number of routes; requests
+// matching no route are labelled with an empty route.
+type Metrics struct {
+	durationBuckets []float64
+	sizeBuckets     []float64
+	inFlight        atomic.Int64
+
+	mu     sync.Mutex
+	series map[metricLabels]*metricSeries
+}
+
+type metricLabels struct {
+	method string
+	route  string
+	status string
+}
+
+type metricSeries struct {
+	count    uint64
+	duration histogram
+	size     histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+}
+
+func (h *histogram) observe(buckets []float64, value float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	for i, bound := range buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+}
+
+// NewMetrics creates an empty metrics registry.
+func NewMetrics(options MetricsOptions) *Metrics {
+	if len(options.DurationBuckets) == 0 {
+		options.DurationBuckets = DefaultDurationBuckets
+	}
+	if len(options.SizeBuckets) == 0 {
+		options.SizeBuckets = DefaultSizeBuckets
+	}
+	return &Metrics{
+		durationBuckets: slices.Sorted(slices.Values(options.DurationBuckets)),
+		sizeBuckets:     slices.Sorted(slices.Values(options.SizeBuckets)),
+		series:          map[metricLabels]*metricSeries{},
+	}
+}
+
+// Metrics records request metrics for router and registers the exposition
+// endpoint at pattern, ex. router.Metrics("/metrics").
+func (router *Router) Metrics(pattern string) *Metrics {
+	metrics := NewMetrics(MetricsOptions{})
+	router.Use(metrics.Middleware)
+	router.Get(pattern, metrics.ServeHTTP)
+	return metrics
+}
+
+// Middleware records the count, latency and response size of requests
+// and the number of requests in flight.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+		start := time.Now()
+		r = trackPattern(r)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		m.observe(r.Method, Pattern(r), rec.status, time.Since(start), rec.size)
+	})
+}
+
+func (m *Metrics) observe(method, pattern string, status int, duration time.Duration,
+	size int64,
+) {
+	labels := metricLabels{
+		method: metricMethod(method),
+		route:  routeOf(pattern),
+		status: strconv.Itoa(status),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series := m.series[labels]
+	if series == nil {
+		series = &metricSeries{}
+		m.series[labels] = series
+	}
+	series.count++
+	series.duration.observe(m.durationBuckets, duration.Seconds())
+	series.size.observe(m.sizeBuckets, float64(size))
+}
+
+// ServeHTTP renders the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf := bufio.NewWriter(w)
+	defer buf.Flush()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]metricLabels, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b metricLabels) int {
+		return cmp.Or(strings.Compare(a.route, b.route), strings.Compare(a.method, b.method),
+			strings.Compare(a.status, b.status))
+	})
+
+	fmt.Fprintf(buf, "# HELP http_requests_total Total number of HTTP requests.\n")
+	fmt.Fprintf(buf, "# TYPE http_requests_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(buf, "http_requests_total{%s} %d\n", key, m.series[key].count)
+	}
+	fmt.Fprintf(buf, "# HELP http_requests_in_flight Number of HTTP requests being served.\n")
+	fmt.Fprintf(buf, "# TYPE http_requests_in_flight gauge\n")
+	fmt.Fprintf(buf, "http_requests_in_flight %d\n", m.inFlight.Load())
+	writeHistogram(buf, "http_request_duration_seconds", "HTTP request latency in seconds.",
+		m.durationBuckets, keys, func(s *metricSeries) *histogram { return &s.duration }, m.series)
+	writeHistogram(buf, "http_response_size_bytes", "HTTP response size in bytes.",
+		m.sizeBuckets, keys, func(s *metricSeries) *histogram { return &s.size }, m.series)
+}
+
+func writeHistogram(buf *bufio.Writer, name, help string, buckets []float64,
+	keys []metricLabels, get func(*metricSeries) *histogram,
+	series map[metricLabels]*metricSeries,
+) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s histogram\n", name)
+	for _, key := range keys {
+		hist := get(series[key])
+		for i, bound := range buckets {
+			fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", name, key, formatFloat(bound),
+				hist.counts[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, key, series[key].count)
+		fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, key, formatFloat(hist.sum))
+		fmt.Fprintf(buf, "%s_count{%s} %d\n", name, key, series[key].count)
+	}
+}
+
+// String formats the labels for the exposition format.
+func (l metricLabels) String() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\",status=\"%s\"",
+		labelEscaper.Replace(l.method), labelEscaper.Replace(l.route),
+		labelEscaper.Replace(l.status))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// metricMethod bounds the method label to the standard methods.
+func metricMethod(method string) string {
+	if slices.Contains(allMethods(), method) {
+		return method
+	}
+	return "OTHER"
+}
+
+// routeOf returns the path of a pattern without the method.
+func routeOf(pattern string) string {
+	if i := strings.IndexByte(pattern, ' '); i >= 0 && !strings.Contains(pattern[:i], "/") {
+		return pattern[i+1:]
+	}
+	return pattern
+}
@@ -0,0 +1,83 @@
+package mux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	router := NewRouter()
+	router.Metrics("/metrics")
+	api := router.Group("/api", Timeout(time.Second))
+	api.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if Pattern(r) != "GET /api/users/{id}" {
+			t.Errorf("Expected full pattern, got '%s'", Pattern(r))
+		}
+		io.WriteString(w, "user "+r.PathValue("id"))
+	})
+	for _, path := range []string{"/api/users/1", "/api/users/2", "/api/missing", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{method="GET",route="/api/users/{id}",status="200"} 2`,
+		`http_requests_total{method="GET",route="",status="404"} 2`,
+		"http_requests_in_flight 1",
+		`http_request_duration_seconds_bucket{method="GET",route="/api/users/{id}",` +
+			`status="200",le="+Inf"} 2`,
+		`http_response_size_bytes_bucket{method="GET",route="/api/users/{id}",` +
+			`status="200",le="100"} 2`,
+		`http_response_size_bytes_sum{method="GET",route="/api/users/{id}",status="200"} 12`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected '%s' in metrics, got\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsGroup(t *testing.T) {
+	metrics := NewMetrics(MetricsOptions{})
+	router := NewRouter()
+	handler := func(http.ResponseWriter, *http.Request) {}
+	router.Group("/api", metrics.Middleware).Get("/users/{id}", handler)
+	router.Group("/admin").Group("/v1", metrics.Middleware).Get("/users/{id}", handler)
+	for _, path := range []string{"/api/users/1", "/admin/v1/users/2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/api/users/{id}",status="200"} 1`,
+		`http_requests_total{method="GET",route="/admin/v1/users/{id}",status="200"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected '%s' in metrics, got\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestJoinPattern(t *testing.T) {
+	tests := []struct {
+		prefix, pattern, want string
+	}{
+		{"/api", "GET\t/users", "GET /api/users"},
+		{"/api", "/users/{id}", "/api/users/{id}"},
+		{"/a/b", "POST /{$}", "POST /a/b/{$}"},
+		{"/api", "", ""},
+	}
+	for _, tt := range tests {
+		if got := joinPattern(tt.prefix, tt.pattern); got != tt.want {
+			t.Errorf("Expected '%s', got '%s'", tt.want, got)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package mux
 
 import (
+	"bufio"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
 )
@@ -11,6 +13,7 @@ type statusRecorder struct {
 	http.ResponseWriter
 
 	status int
+	size   int64
 }
 
 // WriteHeader overrides std WriteHeader to save response code.
@@ -19,11 +22,35 @@ func (rec *statusRecorder) WriteHeader(code int) {
 	rec.ResponseWriter.WriteHeader(code)
 }
 
+// Write overrides std Write to count the response size.
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += int64(n)
+	return n, err
+}
+
+// Hijack takes over the connection, ex. for WebSocket, and records the
+// switch of protocols.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
 // Logger is a logging middleware that logs useragent, RemoteAddr, Method, Host, Path and response.Status to stdlib log.
+// Metrics recorded with AddTiming or StartTiming are appended in Server-Timing format.
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		now := time.Now()
-		rec := statusRecorder{w, http.StatusOK}
+		r, collected := withTimings(r)
+		rec := statusRecorder{ResponseWriter: w, status: http.StatusOK}
 		next.ServeHTTP(&rec, r)
 		// remote := strings.Split(r.RemoteAddr, ":")[0]
 		remote := r.RemoteAddr
@@ -40,6 +67,9 @@ func Logger(next http.Handler) http.Handler {
 			time.Since(now).String(),
 			r.UserAgent(),
 		)
+		if metrics := collected.list(); len(metrics) > 0 {
+			details += " " + formatTimings(metrics)
+		}
 		slog.Info(details)
 	})
 }
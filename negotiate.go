@@ -0,0 +1,78 @@
+package mux
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Negotiate returns the media type from offers that best matches the
+// Accept header of the request. Offers are listed in order of the servers
+// preference, which breaks ties. A request without an Accept header gets
+// the first offer; an empty string is returned if no offer is acceptable.
+func Negotiate(r *http.Request, offers ...string) string {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for part := range strings.SplitSeq(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality of offer using the most specific
+// matching range.
+func acceptQuality(ranges []acceptRange, offer string) float64 {
+	offerType, _, _ := strings.Cut(offer, "/")
+	q, specificity := 0.0, -1
+	for _, accept := range ranges {
+		rangeType, rangeSub, _ := strings.Cut(accept.mediaType, "/")
+		var match int
+		switch {
+		case accept.mediaType == offer:
+			match = 2
+		case rangeType == offerType && rangeSub == "*":
+			match = 1
+		case accept.mediaType == "*/*":
+			match = 0
+		default:
+			continue
+		}
+		if match > specificity {
+			q, specificity = accept.q, match
+		}
+	}
+	return q
+}
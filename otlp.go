@@ -0,0 +1,284 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOTLPEndpoint  = "http://localhost:4318/v1/traces"
+	defaultOTLPBatch     = 512
+	defaultOTLPInterval  = 5 * time.Second
+	defaultOTLPQueueSize = 4096
+	otlpSpanKindServer   = 2
+	otlpStatusError      = 2
+	instrumentationScope = "github.com/devilcove/mux"
+)
+
+var errExporterClosed = errors.New("exporter is shut down")
+
+// OTLPOptions configures NewOTLPExporter.
+type OTLPOptions struct {
+	// Endpoint is the OTLP/HTTP traces endpoint of the collector.
+	// Defaults to http://localhost:4318/v1/traces.
+	Endpoint string
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+	// Headers are added to export requests, ex. for authentication.
+	Headers http.Header
+	// BatchSize is the maximum number of spans per export request.
+	// Defaults to 512.
+	BatchSize int
+	// Interval is the maximum time spans wait before being exported.
+	// Defaults to 5 seconds.
+	Interval time.Duration
+	// Client sends the export requests. Defaults to a client with a 10
+	// second timeout.
+	Client *http.Client
+}
+
+// OTLPExporter exports spans to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding. Spans are queued and sent in batches by a background
+// goroutine; spans are dropped when the queue is full.
+type OTLPExporter struct {
+	options OTLPOptions
+	queue   chan *Span
+	flush   chan chan struct{}
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewOTLPExporter starts an exporter. Call Shutdown to send queued spans
+// and stop it.
+func NewOTLPExporter(options OTLPOptions) *OTLPExporter {
+	if options.Endpoint == "" {
+		options.Endpoint = defaultOTLPEndpoint
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultOTLPBatch
+	}
+	if options.Interval <= 0 {
+		options.Interval = defaultOTLPInterval
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	exporter := &OTLPExporter{
+		options: options,
+		queue:   make(chan *Span, defaultOTLPQueueSize),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go exporter.run()
+	return exporter
+}
+
+// Export queues the span.
+func (e *OTLPExporter) Export(_ context.Context, span *Span) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return errExporterClosed
+	}
+	select {
+	case e.queue <- span:
+		return nil
+	default:
+		return errors.New("span queue is full")
+	}
+}
+
+// Flush sends all queued spans.
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case e.flush <- done:
+	case <-e.done:
+		return errExporterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown sends all queued spans and stops the exporter.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	close(e.queue)
+	e.mu.Unlock()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.options.Interval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, e.options.BatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			slog.Error("OTLPExporter: failed to export spans", "error", err, "spans", len(batch))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span, ok := <-e.queue:
+			if !ok {
+				send()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= e.options.BatchSize {
+				send()
+			}
+		case done := <-e.flush:
+			for drained := false; !drained; {
+				select {
+				case span, ok := <-e.queue:
+					if !ok {
+						drained = true
+						break
+					}
+					batch = append(batch, span)
+				default:
+					drained = true
+				}
+			}
+			send()
+			close(done)
+		case <-ticker.C:
+			send()
+		}
+	}
+}
+
+func (e *OTLPExporter) send(spans []*Span) error {
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+		e.options.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range e.options.Headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.options.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            map[string]int  `json:"status"`
+}
+
+// payload builds an OTLP ExportTraceServiceRequest.
+func (e *OTLPExporter) payload(spans []*Span) map[string]any {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		item := otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			TraceState:        span.TraceState,
+			Name:              span.Name,
+			Kind:              otlpSpanKindServer,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Status:            map[string]int{},
+		}
+		if span.ParentID.IsValid() {
+			item.ParentSpanID = span.ParentID.String()
+		}
+		if span.Status >= http.StatusInternalServerError {
+			item.Status["code"] = otlpStatusError
+		}
+		for key, value := range span.Attributes() {
+			item.Attributes = append(item.Attributes, otlpAttribute{Key: key, Value: otlpValue(value)})
+		}
+		converted = append(converted, item)
+	}
+	resource := []otlpAttribute{}
+	if e.options.ServiceName != "" {
+		resource = append(resource, otlpAttribute{
+			Key: "service.name", Value: otlpValue(e.options.ServiceName),
+		})
+	}
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": resource},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": instrumentationScope},
+				"spans": converted,
+			}},
+		}},
+	}
+}
+
+// otlpValue converts an attribute value to an OTLP AnyValue.
+func otlpValue(value any) map[string]any {
+	switch v := value.(type) {
+	case string:
+		return map[string]any{"stringValue": v}
+	case bool:
+		return map[string]any{"boolValue": v}
+	case int:
+		return map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]any{"doubleValue": v}
+	default:
+		return map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+}
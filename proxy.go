@@ -0,0 +1,542 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultProxyRetries   = 2
+	defaultMaxFails       = 3
+	defaultFailTimeout    = 10 * time.Second
+	defaultHealthInterval = 10 * time.Second
+)
+
+// ErrNoUpstream is returned when all upstreams of a proxy are unavailable;
+// it is answered with 503 Service Unavailable.
+var ErrNoUpstream = errors.New("mux: no upstream available")
+
+// ProxyOptions configures the handler registered by ProxyWithOptions.
+type ProxyOptions struct {
+	// StripPrefix removes the static prefix of the pattern from the request
+	// path, like Group does with http.StripPrefix. The path of the upstream
+	// URL is prepended, so "/api/" stripped and proxied to
+	// http://backend/v2 forwards /api/users as /v2/users.
+	StripPrefix bool
+	// Balancer selects the upstream of a request. Defaults to RoundRobin.
+	Balancer Balancer
+	// Retries is the number of other upstreams tried when an idempotent
+	// request without a body fails to connect. Defaults to 2, a negative
+	// value disables retries.
+	Retries int
+	// MaxFails is the number of consecutive failed requests after which an
+	// upstream is skipped for FailTimeout. Connection errors and 502 Bad
+	// Gateway, 503 Service Unavailable and 504 Gateway Timeout responses of
+	// the upstream count as failures. Defaults to 3.
+	MaxFails int
+	// FailTimeout is the time an upstream is skipped after MaxFails
+	// failures. Defaults to 10 seconds.
+	FailTimeout time.Duration
+	// HealthCheck is the path polled on each upstream, ex. "/healthz".
+	// Upstreams answering with an error status or not at all are skipped
+	// until they recover. Disabled when empty.
+	HealthCheck string
+	// HealthInterval is the interval of health checks. Defaults to 10
+	// seconds.
+	HealthInterval time.Duration
+	// HealthTimeout limits the time of a health check. Defaults to 2
+	// seconds.
+	HealthTimeout time.Duration
+	// TrustForwarded appends to the Forwarded and X-Forwarded-* headers of
+	// the request, for proxies behind a trusted load balancer. By default
+	// they are replaced, so clients cannot spoof them.
+	TrustForwarded bool
+	// Transport sends the requests to the upstreams. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Upstream is a server of a proxy.
+type Upstream struct {
+	URL *url.URL
+
+	active    atomic.Int64
+	unhealthy atomic.Bool
+
+	mu        sync.Mutex
+	fails     int
+	downUntil time.Time
+}
+
+// Available reports whether the upstream passes its health checks and is
+// not skipped after failed requests.
+func (u *Upstream) Available() bool {
+	if u.unhealthy.Load() {
+		return false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return time.Now().After(u.downUntil)
+}
+
+// ActiveRequests returns the number of requests in progress.
+func (u *Upstream) ActiveRequests() int64 {
+	return u.active.Load()
+}
+
+func (u *Upstream) succeeded() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fails = 0
+}
+
+func (u *Upstream) failed(maxFails int, timeout time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fails++
+	if u.fails >= maxFails {
+		u.fails = 0
+		u.downUntil = time.Now().Add(timeout)
+	}
+}
+
+// Balancer selects the upstream of a request from the available upstreams,
+// which are never empty.
+type Balancer interface {
+	Select(r *http.Request, upstreams []*Upstream) *Upstream
+}
+
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+// RoundRobin returns a Balancer that selects the upstreams in turn.
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+// Select implements the Balancer interface.
+func (b *roundRobin) Select(_ *http.Request, upstreams []*Upstream) *Upstream {
+	return upstreams[(b.next.Add(1)-1)%uint64(len(upstreams))]
+}
+
+type leastConnections struct {
+	next atomic.Uint64
+}
+
+// LeastConnections returns a Balancer that selects the upstream with the
+// fewest requests in progress, taking turns between equally busy ones.
+func LeastConnections() Balancer {
+	return &leastConnections{}
+}
+
+// Select implements the Balancer interface.
+func (b *leastConnections) Select(_ *http.Request, upstreams []*Upstream) *Upstream {
+	start := b.next.Add(1) - 1
+	var best *Upstream
+	for i := range upstreams {
+		upstream := upstreams[(start+uint64(i))%uint64(len(upstreams))]
+		if best == nil || upstream.ActiveRequests() < best.ActiveRequests() {
+			best = upstream
+		}
+	}
+	return best
+}
+
+type consistentHash struct {
+	key      func(r *http.Request) string
+	fallback roundRobin
+}
+
+// HashHeader returns a Balancer that sends requests with the same value of
+// the header to the same upstream, ex. mux.HashHeader("X-Tenant") . Only
+// the requests of an unavailable upstream move to another one. Requests
+// without the header are balanced round robin.
+func HashHeader(name string) Balancer {
+	return &consistentHash{key: func(r *http.Request) string {
+		return r.Header.Get(name)
+	}}
+}
+
+// HashCookie returns a Balancer that sends requests with the same value of
+// the cookie to the same upstream, like HashHeader.
+func HashCookie(name string) Balancer {
+	return &consistentHash{key: func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}}
+}
+
+// Select implements the Balancer interface with rendezvous hashing.
+func (b *consistentHash) Select(r *http.Request, upstreams []*Upstream) *Upstream {
+	key := b.key(r)
+	if key == "" {
+		return b.fallback.Select(r, upstreams)
+	}
+	var (
+		best  *Upstream
+		score uint64
+	)
+	for _, upstream := range upstreams {
+		h := fnv.New64a()
+		io.WriteString(h, key+"\x00"+upstream.URL.String())
+		if sum := h.Sum64(); best == nil || sum > score {
+			best, score = upstream, sum
+		}
+	}
+	return best
+}
+
+// Proxy forwards requests to upstream servers, see Router.Proxy.
+type Proxy struct {
+	upstreams []*Upstream
+	options   ProxyOptions
+	prefix    string
+	proxy     *httputil.ReverseProxy
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// Proxy registers a reverse proxy for pattern balancing requests over the
+// upstream URLs, ex.
+// router.Proxy("/api/", "http://10.0.0.1:8080", "http://10.0.0.2:8080") .
+// A pattern without a trailing slash is extended with one, as for Static.
+// Failed upstreams answer with 502 Bad Gateway, and 503 Service Unavailable
+// is returned when no upstream is available, both rendered with Error.
+func (router *Router) Proxy(pattern string, upstreams ...string) *Proxy {
+	return router.ProxyWithOptions(pattern, ProxyOptions{}, upstreams...)
+}
+
+// ProxyWithOptions registers a reverse proxy like Proxy, ex.
+// router.ProxyWithOptions("/api/", mux.ProxyOptions{StripPrefix: true,
+// Balancer: mux.HashCookie("session"), HealthCheck: "/healthz"}, upstreams...) .
+// Close stops the health checks.
+func (router *Router) ProxyWithOptions(pattern string, options ProxyOptions,
+	upstreams ...string,
+) *Proxy {
+	if !strings.HasSuffix(pattern, "/") && !strings.HasSuffix(pattern, "...}") {
+		pattern += "/"
+	}
+	proxy := NewProxy(options, upstreams...)
+	if options.StripPrefix {
+		proxy.prefix = patternPrefix(pattern)
+	}
+	router.mount(pattern, proxy)
+	return proxy
+}
+
+// NewProxy returns a reverse proxy handler for the upstream URLs; it panics
+// if an URL is invalid. Router.Proxy registers one on a router.
+func NewProxy(options ProxyOptions, upstreams ...string) *Proxy {
+	if len(upstreams) == 0 {
+		panic("mux.NewProxy: no upstreams")
+	}
+	p := &Proxy{options: options, stop: make(chan struct{})}
+	for _, upstream := range upstreams {
+		u, err := url.Parse(upstream)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			panic("mux.NewProxy: invalid upstream " + upstream)
+		}
+		p.upstreams = append(p.upstreams, &Upstream{URL: u})
+	}
+	if p.options.Balancer == nil {
+		p.options.Balancer = RoundRobin()
+	}
+	if p.options.Retries == 0 {
+		p.options.Retries = defaultProxyRetries
+	}
+	if p.options.MaxFails <= 0 {
+		p.options.MaxFails = defaultMaxFails
+	}
+	if p.options.FailTimeout <= 0 {
+		p.options.FailTimeout = defaultFailTimeout
+	}
+	if p.options.HealthInterval <= 0 {
+		p.options.HealthInterval = defaultHealthInterval
+	}
+	if p.options.HealthTimeout <= 0 {
+		p.options.HealthTimeout = defaultCheckTimeout
+	}
+	if p.options.Transport == nil {
+		p.options.Transport = http.DefaultTransport
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite:      p.rewrite,
+		Transport:    roundTripperFunc(p.roundTrip),
+		ErrorHandler: p.error,
+	}
+	if p.options.HealthCheck != "" {
+		go p.checkHealth()
+	}
+	return p
+}
+
+// patternPrefix returns the static path prefix of pattern, ex. "/api" for
+// "GET example.com/api/{path...}".
+func patternPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		pattern = strings.TrimSpace(pattern[i+1:])
+	}
+	if i := strings.Index(pattern, "/"); i >= 0 {
+		pattern = pattern[i:]
+	}
+	if i := strings.Index(pattern, "{"); i >= 0 {
+		pattern = pattern[:i]
+	}
+	return strings.TrimSuffix(pattern, "/")
+}
+
+// Upstreams returns the upstreams of the proxy.
+func (p *Proxy) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// Close stops the health checks.
+func (p *Proxy) Close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.proxy.ServeHTTP(w, r)
+}
+
+// rewrite strips the prefix and sets the forwarding headers; the upstream
+// is chosen by roundTrip.
+func (p *Proxy) rewrite(pr *httputil.ProxyRequest) {
+	if p.prefix != "" {
+		pr.Out.URL.Path = stripPath(pr.Out.URL.Path, p.prefix)
+		if pr.Out.URL.RawPath != "" {
+			pr.Out.URL.RawPath = stripPath(pr.Out.URL.RawPath, p.prefix)
+		}
+	}
+	if p.options.TrustForwarded {
+		pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+	}
+	pr.SetXForwarded()
+	forwarded := forwardedElement(pr.In)
+	if p.options.TrustForwarded {
+		for _, name := range []string{"X-Forwarded-Host", "X-Forwarded-Proto"} {
+			if value := pr.In.Header.Get(name); value != "" {
+				pr.Out.Header.Set(name, value)
+			}
+		}
+		if prior := strings.Join(pr.In.Header.Values("Forwarded"), ", "); prior != "" {
+			forwarded = prior + ", " + forwarded
+		}
+	}
+	pr.Out.Header.Set("Forwarded", forwarded)
+}
+
+func stripPath(p, prefix string) string {
+	p = strings.TrimPrefix(p, prefix)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// forwardedElement describes the client of r for the Forwarded header, see
+// RFC 7239.
+func forwardedElement(r *http.Request) string {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	if strings.Contains(client, ":") {
+		client = "[" + client + "]"
+	}
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	return "for=" + forwardedValue(client) + ";host=" + forwardedValue(r.Host) +
+		";proto=" + proto
+}
+
+// forwardedValue quotes value unless it is a token.
+func forwardedValue(value string) string {
+	if value != "" && !strings.ContainsFunc(value, func(r rune) bool {
+		return r > '~' || r <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r)
+	}) {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// roundTrip sends the request to an upstream chosen by the balancer,
+// trying other upstreams for idempotent requests that fail.
+func (p *Proxy) roundTrip(r *http.Request) (*http.Response, error) {
+	attempts := 1
+	if p.options.Retries > 0 && retryable(r) {
+		attempts += p.options.Retries
+	}
+	tried := map[*Upstream]bool{}
+	err := ErrNoUpstream
+	for range attempts {
+		var available []*Upstream
+		for _, upstream := range p.upstreams {
+			if !tried[upstream] && upstream.Available() {
+				available = append(available, upstream)
+			}
+		}
+		if len(available) == 0 {
+			break
+		}
+		upstream := p.options.Balancer.Select(r, available)
+		tried[upstream] = true
+		upstream.active.Add(1)
+		var resp *http.Response
+		resp, err = p.options.Transport.RoundTrip(upstreamRequest(r, upstream.URL))
+		if err == nil {
+			switch resp.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable,
+				http.StatusGatewayTimeout:
+				upstream.failed(p.options.MaxFails, p.options.FailTimeout)
+			default:
+				upstream.succeeded()
+			}
+			resp.Body = trackBody(resp.Body, func() { upstream.active.Add(-1) })
+			return resp, nil
+		}
+		upstream.active.Add(-1)
+		if r.Context().Err() != nil {
+			return nil, err
+		}
+		upstream.failed(p.options.MaxFails, p.options.FailTimeout)
+	}
+	return nil, err
+}
+
+func retryable(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return r.Body == nil || r.Body == http.NoBody
+	}
+	return false
+}
+
+// upstreamRequest returns a copy of r sent to target, joining the paths and
+// queries like httputil.ProxyRequest.SetURL.
+func upstreamRequest(r *http.Request, target *url.URL) *http.Request {
+	out := r.Clone(r.Context())
+	out.Host = ""
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+	if target.Path != "" {
+		if out.URL.RawPath != "" || target.RawPath != "" {
+			out.URL.RawPath = joinPath(target.EscapedPath(), out.URL.EscapedPath())
+		}
+		out.URL.Path = joinPath(target.Path, out.URL.Path)
+	}
+	if target.RawQuery != "" && out.URL.RawQuery != "" {
+		out.URL.RawQuery = target.RawQuery + "&" + out.URL.RawQuery
+	} else {
+		out.URL.RawQuery = target.RawQuery + out.URL.RawQuery
+	}
+	return out
+}
+
+func joinPath(a, b string) string {
+	return strings.TrimSuffix(a, "/") + "/" + strings.TrimPrefix(b, "/")
+}
+
+// trackBody calls done once the response body is closed. The body of
+// upgraded connections stays writable for httputil.ReverseProxy.
+func trackBody(body io.ReadCloser, done func()) io.ReadCloser {
+	closer := &trackedBody{ReadCloser: body, done: done}
+	if rw, ok := body.(io.ReadWriteCloser); ok {
+		return &trackedUpgrade{trackedBody: closer, writer: rw}
+	}
+	return closer
+}
+
+type trackedBody struct {
+	io.ReadCloser
+
+	once sync.Once
+	done func()
+}
+
+// Close closes the body and reports it once.
+func (b *trackedBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
+
+type trackedUpgrade struct {
+	*trackedBody
+
+	writer io.Writer
+}
+
+// Write writes to the upgraded connection.
+func (b *trackedUpgrade) Write(p []byte) (int, error) {
+	return b.writer.Write(p)
+}
+
+// error renders failed proxy requests.
+func (p *Proxy) error(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		// the client went away
+		return
+	}
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, ErrNoUpstream):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	Error(w, r, &HTTPError{Status: status, Err: err})
+}
+
+// checkHealth polls the health check of the upstreams until Close.
+func (p *Proxy) checkHealth() {
+	client := &http.Client{Transport: p.options.Transport, Timeout: p.options.HealthTimeout}
+	ticker := time.NewTicker(p.options.HealthInterval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for _, upstream := range p.upstreams {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				healthy := false
+				resp, err := client.Get(joinPath(upstream.URL.String(), p.options.HealthCheck))
+				if err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					healthy = resp.StatusCode < http.StatusBadRequest
+				}
+				upstream.unhealthy.Store(!healthy)
+			}()
+		}
+		wg.Wait()
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package mux
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBackend starts an upstream answering with its name, the request path
+// and the forwarding headers.
+func newBackend(t *testing.T, name string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s|%s|%s|%s", name, r.URL.RequestURI(),
+			r.Header.Get("X-Forwarded-For"), r.Header.Get("Forwarded"), r.Host)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func proxyGet(router http.Handler, path string, header http.Header) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func TestProxyRewrite(t *testing.T) {
+	backend := newBackend(t, "a")
+	router := NewRouter()
+	router.ProxyWithOptions("/api/", ProxyOptions{StripPrefix: true}, backend.URL+"/v2?key=1")
+	router.Group("/shop").Proxy("/", backend.URL)
+	router.ProxyWithOptions("/bare", ProxyOptions{StripPrefix: true}, backend.URL)
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/api/users?page=2", "a /v2/users?key=1&page=2"},
+		{"/api/", "a /v2/?key=1"},
+		{"/shop/cart", "a /cart"},
+		{"/bare/item", "a /item"},
+	}
+	for _, tt := range tests {
+		_, body := proxyGet(router, tt.path, nil)
+		if got, _, _ := strings.Cut(body, "|"); got != tt.want {
+			t.Errorf("Expected '%s', got '%s'", tt.want, got)
+		}
+		if !strings.HasSuffix(body, strings.TrimPrefix(backend.URL, "http://")) {
+			t.Error("expected upstream host, got", body)
+		}
+	}
+	if prefix := patternPrefix("GET example.com/files/{path...}"); prefix != "/files" {
+		t.Errorf("Expected '/files', got '%s'", prefix)
+	}
+}
+
+func TestProxyForwarded(t *testing.T) {
+	backend := newBackend(t, "a")
+	router := NewRouter()
+	router.Proxy("/", backend.URL)
+	trusted := router.Group("/trusted")
+	trusted.ProxyWithOptions("/", ProxyOptions{TrustForwarded: true}, backend.URL)
+
+	spoofed := http.Header{
+		"X-Forwarded-For": {"203.0.113.9"},
+		"Forwarded":       {"for=203.0.113.9"},
+	}
+	_, body := proxyGet(router, "/", spoofed)
+	parts := strings.Split(body, "|")
+	if parts[1] != "192.0.2.1" || parts[2] != "for=192.0.2.1;host=example.com;proto=http" {
+		t.Error("expected spoofed headers replaced, got", parts[1], parts[2])
+	}
+	_, body = proxyGet(router, "/trusted/", spoofed)
+	parts = strings.Split(body, "|")
+	if parts[1] != "203.0.113.9, 192.0.2.1" ||
+		parts[2] != "for=203.0.113.9, for=192.0.2.1;host=example.com;proto=http" {
+		t.Error("expected headers appended, got", parts[1], parts[2])
+	}
+	if got := forwardedElement(&http.Request{RemoteAddr: "[2001:db8::1]:80", Host: "a:8"}); got !=
+		`for="[2001:db8::1]";host="a:8";proto=http` {
+		t.Error("expected quoted IPv6 and host, got", got)
+	}
+}
+
+func TestProxyBalancers(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	names := func(router http.Handler, requests int, header http.Header) string {
+		var got []string
+		for range requests {
+			_, body := proxyGet(router, "/", header)
+			got = append(got, body[:1])
+		}
+		return strings.Join(got, "")
+	}
+
+	router := NewRouter()
+	router.Proxy("/", a.URL, b.URL)
+	if got := names(router, 4, nil); got != "abab" {
+		t.Errorf("Expected 'abab', got '%s'", got)
+	}
+
+	router = NewRouter()
+	router.ProxyWithOptions("/", ProxyOptions{Balancer: HashHeader("X-Tenant")}, a.URL, b.URL)
+	spread := map[string]bool{}
+	for tenant := range 20 {
+		got := names(router, 3, http.Header{"X-Tenant": {fmt.Sprint("tenant", tenant)}})
+		if got != strings.Repeat(got[:1], 3) {
+			t.Error("expected sticky upstream, got", got)
+		}
+		spread[got[:1]] = true
+	}
+	if len(spread) != 2 {
+		t.Error("expected tenants spread over both upstreams, got", spread)
+	}
+
+	router = NewRouter()
+	router.ProxyWithOptions("/", ProxyOptions{Balancer: HashCookie("session")}, a.URL, b.URL)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	first := ""
+	for range 3 {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if first == "" {
+			first = w.Body.String()[:1]
+		}
+		if w.Body.String()[:1] != first {
+			t.Error("expected sticky session, got", w.Body.String())
+		}
+	}
+}
+
+func TestProxyLeastConnections(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		io.WriteString(w, "slow")
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := newBackend(t, "fast")
+	router := NewRouter()
+	proxy := router.ProxyWithOptions("/", ProxyOptions{Balancer: LeastConnections()},
+		slow.URL, fast.URL)
+
+	go proxyGet(router, "/", nil)
+	for proxy.Upstreams()[0].ActiveRequests() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for range 3 {
+		if _, body := proxyGet(router, "/", nil); !strings.HasPrefix(body, "fast") {
+			t.Error("expected idle upstream, got", body)
+		}
+	}
+}
+
+func TestProxyFailover(t *testing.T) {
+	healthy := newBackend(t, "healthy")
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	router := NewRouter()
+	proxy := router.ProxyWithOptions("/", ProxyOptions{MaxFails: 1, FailTimeout: time.Minute},
+		dead.URL, healthy.URL)
+
+	if status, body := proxyGet(router, "/", nil); status != http.StatusOK ||
+		!strings.HasPrefix(body, "healthy") {
+		t.Error("expected retry on healthy upstream, got", status, body)
+	}
+	if proxy.Upstreams()[0].Available() {
+		t.Error("expected failed upstream to be skipped")
+	}
+
+	router = NewRouter()
+	router.ProxyWithOptions("/", ProxyOptions{Retries: -1, MaxFails: 1}, dead.URL)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("order"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadGateway {
+		t.Error("expected", http.StatusBadGateway, "got", w.Code)
+	}
+	if status, _ := proxyGet(router, "/", nil); status != http.StatusServiceUnavailable {
+		t.Error("expected", http.StatusServiceUnavailable, "got", status)
+	}
+
+	overloaded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer overloaded.Close()
+	router = NewRouter()
+	proxy = router.ProxyWithOptions("/", ProxyOptions{MaxFails: 1, FailTimeout: time.Minute},
+		overloaded.URL, healthy.URL)
+	for range 3 {
+		proxyGet(router, "/", nil)
+	}
+	if proxy.Upstreams()[0].Available() {
+		t.Error("expected upstream answering 503 to be skipped")
+	}
+}
+
+func TestProxyHealthCheck(t *testing.T) {
+	var failing atomic.Bool
+	sick := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		io.WriteString(w, "sick")
+	}))
+	defer sick.Close()
+	good := newBackend(t, "good")
+	failing.Store(true)
+	router := NewRouter()
+	proxy := router.ProxyWithOptions("/", ProxyOptions{
+		HealthCheck: "/healthz", HealthInterval: 5 * time.Millisecond,
+	}, sick.URL, good.URL)
+	defer proxy.Close()
+
+	wait := func(available bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for proxy.Upstreams()[0].Available() != available && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wait(false)
+	for range 3 {
+		if _, body := proxyGet(router, "/", nil); !strings.HasPrefix(body, "good") {
+			t.Error("expected healthy upstream, got", body)
+		}
+	}
+	failing.Store(false)
+	wait(true)
+	if !proxy.Upstreams()[0].Available() {
+		t.Error("expected upstream to recover")
+	}
+}
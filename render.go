@@ -0,0 +1,252 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"iter"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const defaultTemplateExtension = ".html"
+
+// WriteJSON writes v as JSON with the given status. v is encoded before
+// anything is written, so an encoding error can still be answered with an
+// error response, ex.
+// return mux.WriteJSON(w, http.StatusCreated, user) .
+func WriteJSON(w http.ResponseWriter, status int, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, status, "application/json", append(body, '\n'))
+}
+
+// WriteXML writes v as XML with the given status, see WriteJSON.
+func WriteXML(w http.ResponseWriter, status int, v any) error {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, status, "application/xml; charset=utf-8",
+		append([]byte(xml.Header), body...))
+}
+
+// WriteText writes text as plain text with the given status.
+func WriteText(w http.ResponseWriter, status int, text string) error {
+	return writeBody(w, status, "text/plain; charset=utf-8", []byte(text))
+}
+
+func writeBody(w http.ResponseWriter, status int, contentType string, body []byte) error {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, err := w.Write(body)
+	return err
+}
+
+// StreamJSON writes the values of seq as newline delimited JSON with the
+// given status, flushing each value so that clients receive them as they
+// are produced. It stops at the first error of seq or of the connection and
+// returns it; the response has already started by then, ex.
+// return mux.StreamJSON(w, http.StatusOK, store.Orders(r.Context())) .
+func StreamJSON[T any](w http.ResponseWriter, status int, seq iter.Seq2[T, error]) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(status)
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	for v, err := range seq {
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	}
+	return nil
+}
+
+// TemplateOptions configures the templates loaded by NewTemplates and
+// NewTemplatesFS. The zero value loads every .html file as a page.
+type TemplateOptions struct {
+	// Extension selects the template files. Defaults to .html.
+	Extension string
+	// Layouts lists glob patterns of templates parsed with every page, such
+	// as layouts and partials, ex. "layouts/*.html". They are named by their
+	// file name, ex. {{template "nav.html" .}}, and are not pages.
+	Layouts []string
+	// Layout is the name of the layout executed to render a page. Pages
+	// fill in the blocks of the layout with define actions, ex.
+	// {{define "content"}}...{{end}}. Without a Layout the page itself is
+	// executed.
+	Layout string
+	// Funcs are added to the templates before parsing.
+	Funcs template.FuncMap
+	// Reload parses the templates again for every render, so that changes
+	// show up without a restart during development.
+	Reload bool
+}
+
+// Templates is a set of HTML pages, see Router.Templates and Render.
+type Templates struct {
+	fsys    fs.FS
+	options TemplateOptions
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+// NewTemplates loads the templates of the directory dir. Every template file
+// not matching TemplateOptions.Layouts is a page named by its path without
+// the extension, ex. "users/show" for dir/users/show.html.
+// ex.
+// templates, err := mux.NewTemplates("views", mux.TemplateOptions{
+// Layouts: []string{"layouts/*.html"}, Layout: "base.html"}) .
+func NewTemplates(dir string, options ...TemplateOptions) (*Templates, error) {
+	return NewTemplatesFS(os.DirFS(dir), options...)
+}
+
+// NewTemplatesFS loads the templates of FS filesystem like NewTemplates.
+// ex.
+// //go:embed views
+// var views embed.FS
+// templates, err := mux.NewTemplatesFS(views) .
+func NewTemplatesFS(fsys fs.FS, options ...TemplateOptions) (*Templates, error) {
+	templates := &Templates{fsys: fsys}
+	if len(options) > 0 {
+		templates.options = options[0]
+	}
+	if templates.options.Extension == "" {
+		templates.options.Extension = defaultTemplateExtension
+	}
+	pages, err := templates.load()
+	if err != nil {
+		return nil, err
+	}
+	templates.pages = pages
+	return templates, nil
+}
+
+// load parses the layouts and every page with a copy of them.
+func (t *Templates) load() (map[string]*template.Template, error) {
+	base := template.New("").Funcs(t.options.Funcs)
+	if len(t.options.Layouts) > 0 {
+		var err error
+		if base, err = base.ParseFS(t.fsys, t.options.Layouts...); err != nil {
+			return nil, err
+		}
+	}
+	if t.options.Layout != "" && base.Lookup(t.options.Layout) == nil {
+		return nil, fmt.Errorf("mux: layout %q not found", t.options.Layout)
+	}
+	pages := map[string]*template.Template{}
+	err := fs.WalkDir(t.fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || path.Ext(name) != t.options.Extension ||
+			t.isLayout(name) {
+			return err
+		}
+		content, err := fs.ReadFile(t.fsys, name)
+		if err != nil {
+			return err
+		}
+		page, err := base.Clone()
+		if err != nil {
+			return err
+		}
+		pageName := strings.TrimSuffix(name, t.options.Extension)
+		if _, err := page.New(pageName).Parse(string(content)); err != nil {
+			return err
+		}
+		pages[pageName] = page
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+func (t *Templates) isLayout(name string) bool {
+	for _, pattern := range t.options.Layouts {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecuteTemplate renders the page name with data to w.
+func (t *Templates) ExecuteTemplate(w io.Writer, name string, data any) error {
+	if t.options.Reload {
+		pages, err := t.load()
+		if err != nil {
+			return err
+		}
+		t.mu.Lock()
+		t.pages = pages
+		t.mu.Unlock()
+	}
+	t.mu.RLock()
+	page, ok := t.pages[name]
+	t.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("mux: template %q not found", name)
+	}
+	if t.options.Layout != "" {
+		return page.ExecuteTemplate(w, t.options.Layout, data)
+	}
+	return page.ExecuteTemplate(w, name, data)
+}
+
+// Templates sets the templates used by Render for requests served by the
+// router. Groups use the templates of their parent unless they set their
+// own, ex.
+// router.Templates(templates) .
+func (router *Router) Templates(templates *Templates) *Router {
+	router.registry().views = templates
+	router.root().rendering = true
+	return router
+}
+
+// Render writes data with status 200 OK, see RenderStatus.
+func Render(w http.ResponseWriter, r *http.Request, name string, data any) error {
+	return RenderStatus(w, r, http.StatusOK, name, data)
+}
+
+// RenderStatus writes data in the format preferred by the client: the page
+// name of the templates of the router serving the request for HTML, or data
+// encoded with WriteJSON or WriteXML for clients preferring JSON or XML.
+// Pages are rendered to a buffer first, so a template error writes nothing
+// and is returned to be answered with an error response, ex.
+// return mux.RenderStatus(w, r, http.StatusUnprocessableEntity, "signup", form) .
+func RenderStatus(w http.ResponseWriter, r *http.Request, status int, name string,
+	data any,
+) error {
+	w.Header().Add("Vary", "Accept")
+	switch Negotiate(r, "text/html", "application/json", "application/xml", "text/xml") {
+	case "application/json":
+		return WriteJSON(w, status, data)
+	case "application/xml", "text/xml":
+		return WriteXML(w, status, data)
+	}
+	scope := currentScope(r)
+	if scope.templates == nil {
+		return errors.New("mux.Render: no templates set for " + r.URL.Path)
+	}
+	var buf bytes.Buffer
+	if err := scope.templates.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+	return writeBody(w, status, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,169 @@
+package mux
+
+import (
+	"errors"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type page struct {
+	Title string `json:"title" xml:"title"`
+}
+
+var views = fstest.MapFS{
+	"layouts/base.html": {Data: []byte(`<title>{{.Title}}</title>{{template "nav.html"}}` +
+		`<main>{{block "content" .}}{{end}}</main>`)},
+	"layouts/nav.html":  {Data: []byte(`<nav>home</nav>`)},
+	"home.html":         {Data: []byte(`{{define "content"}}Welcome {{upper .Title}}{{end}}`)},
+	"users/show.html":   {Data: []byte(`{{define "content"}}User {{.Title}}{{end}}`)},
+	"broken.html":       {Data: []byte(`{{define "content"}}{{.Missing}}{{end}}`)},
+	"static/readme.txt": {Data: []byte(`not a template`)},
+}
+
+func TestRender(t *testing.T) {
+	templates, err := NewTemplatesFS(views, TemplateOptions{
+		Layouts: []string{"layouts/*.html"},
+		Layout:  "base.html",
+		Funcs:   map[string]any{"upper": strings.ToUpper},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter()
+	router.Templates(templates)
+	router.GetE("/{page...}", func(w http.ResponseWriter, r *http.Request) error {
+		return Render(w, r, r.PathValue("page"), page{Title: "mux"})
+	})
+
+	tests := []struct {
+		path, accept string
+		status       int
+		contentType  string
+		body         string
+	}{
+		{"/home", "", http.StatusOK, "text/html; charset=utf-8",
+			"<title>mux</title><nav>home</nav><main>Welcome MUX</main>"},
+		{"/users/show", "text/html,*/*;q=0.8", http.StatusOK, "text/html; charset=utf-8",
+			"<title>mux</title><nav>home</nav><main>User mux</main>"},
+		{"/home", "application/json", http.StatusOK, "application/json",
+			`{"title":"mux"}` + "\n"},
+		{"/home", "application/xml", http.StatusOK, "application/xml; charset=utf-8",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<page><title>mux</title></page>`},
+		{"/broken", "", http.StatusInternalServerError, "text/plain; charset=utf-8",
+			"Internal Server Error\n"},
+		{"/missing", "", http.StatusInternalServerError, "text/plain; charset=utf-8",
+			"Internal Server Error\n"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.status || w.Header().Get("Content-Type") != tt.contentType ||
+			w.Body.String() != tt.body {
+			t.Error("expected", tt.status, tt.contentType, tt.body, "got", w.Code,
+				w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestRenderGroupTemplates(t *testing.T) {
+	site, err := NewTemplatesFS(fstest.MapFS{"index.html": {Data: []byte("site")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := NewTemplatesFS(fstest.MapFS{"index.html": {Data: []byte("admin")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := func(w http.ResponseWriter, r *http.Request) error {
+		return Render(w, r, "index", nil)
+	}
+	router := NewRouter()
+	router.Templates(site)
+	router.GetE("/{$}", index)
+	group := router.Group("/admin")
+	group.Templates(admin)
+	group.GetE("/", index)
+	for path, want := range map[string]string{"/": "site", "/admin/": "admin"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() != want {
+			t.Errorf("Expected '%s', got '%s'", want, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	err = Render(w, httptest.NewRequest(http.MethodGet, "/", nil), "index", nil)
+	if err == nil || w.Body.Len() != 0 {
+		t.Error("expected error without templates, got", err, w.Body.String())
+	}
+}
+
+func TestTemplatesReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(file, []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := NewTemplates(dir, TemplateOptions{Reload: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("v2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var body strings.Builder
+	if err := templates.ExecuteTemplate(&body, "index", nil); err != nil {
+		t.Fatal(err)
+	}
+	if body.String() != "v2" {
+		t.Errorf("Expected 'v2', got '%s'", body.String())
+	}
+
+	if _, err := NewTemplates(dir, TemplateOptions{Layout: "base.html"}); err == nil {
+		t.Error("expected error for missing layout")
+	}
+}
+
+func TestStreamJSON(t *testing.T) {
+	failure := errors.New("database gone")
+	seq := func(yield func(page, error) bool) {
+		if !yield(page{Title: "a"}, nil) || !yield(page{Title: "b"}, nil) {
+			return
+		}
+		yield(page{}, failure)
+	}
+	w := httptest.NewRecorder()
+	err := StreamJSON(w, http.StatusOK, iter.Seq2[page, error](seq))
+	if !errors.Is(err, failure) {
+		t.Error("expected", failure, "got", err)
+	}
+	want := `{"title":"a"}` + "\n" + `{"title":"b"}` + "\n"
+	if w.Body.String() != want || !w.Flushed ||
+		w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("Expected '%s', got '%s'", want, w.Body.String())
+	}
+}
+
+func TestWriteHelpers(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := WriteText(w, http.StatusAccepted, "queued"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusAccepted || w.Body.String() != "queued" {
+		t.Error("expected", http.StatusAccepted, "queued", "got", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	if err := WriteJSON(w, http.StatusOK, func() {}); err == nil || w.Body.Len() != 0 {
+		t.Error("expected encoding error before writing, got", err, w.Body.String())
+	}
+}
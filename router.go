@@ -2,12 +2,15 @@
 package mux
 
 import (
+	"context"
 	"errors"
 	"io/fs"
 	"log/slog"
 	"net/http"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,24 +21,41 @@ type Middleware func(http.Handler) http.Handler
 type Router struct {
 	*http.ServeMux
 
+	base       *Router
+	parent     *Router
+	prefix     string
 	chain      http.Handler
+	middleware []namedMiddleware
+	ordered    bool
+	routes     []string
+	groups     []*Router
+	isolated   []isolatedGroup
+	fallback   http.Handler
+	inline     []Middleware
 	methods    []string
 	notFound   func(http.ResponseWriter, *http.Request)
-	notAllowed func(http.ResponseWriter, string, int)
+	notAllowed MethodNotAllowedHandler
+	renderer   ErrorRenderer
+	views      *Templates
+	onError    ErrorHandler
+	rendering  bool
+
+	serverMu   sync.Mutex
+	server     *http.Server
+	draining   atomic.Bool
+	drainDelay time.Duration
 }
 
 // defaultRouter creates a new Router using the default ServeMux.
 func defaultRouter() *Router {
 	mux := http.NewServeMux()
 	router := &Router{
-		ServeMux:   mux,
-		chain:      mux,
-		methods:    []string{},
-		notFound:   http.NotFound,
-		notAllowed: http.Error,
+		ServeMux: mux,
+		chain:    mux,
+		methods:  []string{},
 	}
 	// set up
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		method := r.Method
 		_, current := mux.Handler(r)
 		var allowed []string
@@ -50,13 +70,19 @@ func defaultRouter() *Router {
 			}
 		}
 		r.Method = method
+		if router.fallback != nil && len(allowed) == 0 {
+			setPattern(r, router.fullPrefix(), "/")
+			router.fallback.ServeHTTP(w, r)
+			return
+		}
+		setPattern(r, "", "")
 		if len(allowed) != 0 {
 			w.Header().Set("Allow", strings.Join(allowed, ", "))
-			router.notAllowed(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			router.notAllowedHandler()(w, r, allowed)
 			return
 		}
 		// http.Error(w, "Custom Not Found", http.StatusNotFound)
-		router.notFound(w, r)
+		router.notFoundHandler()(w, r)
 	})
 	return router
 }
@@ -68,41 +94,195 @@ func NewRouter(middleware ...Middleware) *Router {
 	return router
 }
 
-// NotFound sets a custome not found handler.
+// NewOrderedRouter creates a new Router that runs middleware in the order it
+// is registered, ex. with NewOrderedRouter(first, second) first runs before
+// second. Groups and With routers of the router use the same order.
+func NewOrderedRouter(middleware ...Middleware) *Router {
+	router := defaultRouter()
+	router.ordered = true
+	router.Use(middleware...)
+	return router
+}
+
+// NotFound sets a custome not found handler. Groups use the handler of
+// their parent unless they set their own, ex. a JSON handler for /api.
 func (router *Router) NotFound(h func(http.ResponseWriter, *http.Request)) *Router {
-	router.notFound = http.HandlerFunc(h)
+	router.registry().notFound = h
 	return router
 }
 
-// NotAllowed sets a custom method not allowed error.
+// MethodNotAllowedHandler handles requests for a route that exists for other
+// methods. The allowed methods are also set in the Allow header.
+type MethodNotAllowedHandler func(w http.ResponseWriter, r *http.Request, allowed []string)
+
+// NotAllowed sets a custom method not allowed error. Groups use the handler
+// of their parent unless they set their own. See MethodNotAllowed for a
+// handler that receives the request.
 func (router *Router) NotAllowed(h func(http.ResponseWriter, string, int)) *Router {
-	router.notAllowed = h
+	return router.MethodNotAllowed(func(w http.ResponseWriter, _ *http.Request, _ []string) {
+		h(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	})
+}
+
+// MethodNotAllowed sets a custom method not allowed handler that receives
+// the request and the allowed methods, ex. to log the offending method or
+// render a content negotiated error.
+func (router *Router) MethodNotAllowed(h MethodNotAllowedHandler) *Router {
+	router.registry().notAllowed = h
 	return router
 }
 
+// notFoundHandler returns the not found handler of the router or of the
+// closest parent that has one.
+func (router *Router) notFoundHandler() func(http.ResponseWriter, *http.Request) {
+	for router = router.registry(); router != nil; router = router.parent {
+		if router.notFound != nil {
+			return router.notFound
+		}
+	}
+	return defaultNotFound
+}
+
+// notAllowedHandler returns the method not allowed handler of the router or
+// of the closest parent that has one.
+func (router *Router) notAllowedHandler() MethodNotAllowedHandler {
+	for router = router.registry(); router != nil; router = router.parent {
+		if router.notAllowed != nil {
+			return router.notAllowed
+		}
+	}
+	return defaultNotAllowed
+}
+
+// GroupOptions configures Router.GroupWithOptions.
+type GroupOptions struct {
+	// Isolate skips the middleware of the parent routers, ex. for webhooks
+	// that must not pass the authentication of the rest of the site. All
+	// requests under the prefix of an isolated group are served by the
+	// group, even if a parent router has a more specific route.
+	Isolate bool
+}
+
 // Group creates a sub-router for the given prefix and applies middleware to it.
+//
+// Middleware composes the same way regardless of registration order: a
+// request to a route of a group passes all middleware of the parent
+// routers, added with Use before or after the group was created, then the
+// middleware of the group, then the middleware of With for that route.
 func (router *Router) Group(prefix string, middlewares ...Middleware) *Router {
+	return router.GroupWithOptions(prefix, GroupOptions{}, middlewares...)
+}
+
+// GroupWithOptions creates a sub-router like Group, ex.
+// router.GroupWithOptions("/webhooks", mux.GroupOptions{Isolate: true}, verifySignature) .
+func (router *Router) GroupWithOptions(prefix string, options GroupOptions,
+	middlewares ...Middleware,
+) *Router {
 	for _, m := range middlewares {
 		if m == nil {
 			panic("Router.Group: middleware cannot be nil")
 		}
 	}
 
+	parent := router.registry()
 	subRouter := defaultRouter()
-	subRouter.notFound = router.notFound
-	subRouter.notAllowed = router.notAllowed
+	subRouter.parent = parent
+	subRouter.prefix = prefix
+	subRouter.ordered = parent.ordered
+	parent.groups = append(parent.groups, subRouter)
 	subRouter.Use(middlewares...)
-	router.Handle(prefix+"/", http.StripPrefix(prefix, subRouter))
+	router.handle(prefix+"/", http.StripPrefix(prefix, subRouter))
+	if options.Isolate {
+		root := router.root()
+		full := subRouter.fullPrefix()
+		strip := http.StripPrefix(full, subRouter)
+		root.isolated = append(root.isolated, isolatedGroup{
+			prefix: full,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				strip.ServeHTTP(w, trackPattern(r))
+			}),
+		})
+	}
 	return subRouter
 }
 
-// Use adds a chain of middlewares to the router.
+// isolatedGroup is a group served without the middleware of its parents.
+type isolatedGroup struct {
+	prefix  string
+	handler http.Handler
+}
+
+// fullPrefix returns the prefix of a group including the prefixes of its
+// parents.
+func (router *Router) fullPrefix() string {
+	router = router.registry()
+	if router.parent == nil {
+		return router.prefix
+	}
+	return router.parent.fullPrefix() + router.prefix
+}
+
+// Use adds a chain of middlewares to the router. The middleware registered
+// last runs first, unless the router was created with NewOrderedRouter.
+// It panics on a router returned by With.
 func (router *Router) Use(middlewares ...Middleware) {
 	for _, m := range middlewares {
-		router.chain = m(router.chain)
+		router.UseNamed(middlewareName(m), m)
 	}
 }
 
+// With returns a router that registers routes on router with the given
+// middlewares applied to each route handler. The returned router is only
+// used to register routes; Use, UseNamed, InsertBefore, InsertAfter and
+// Remove panic on it, ex.
+// router.With(mux.MaxBodySize(1 << 20)).Post("/upload", upload) .
+func (router *Router) With(middlewares ...Middleware) *Router {
+	for _, m := range middlewares {
+		if m == nil {
+			panic("Router.With: middleware cannot be nil")
+		}
+	}
+	base := router
+	if router.base != nil {
+		base = router.base
+	}
+	return &Router{
+		ServeMux: router.ServeMux,
+		base:     base,
+		chain:    router.chain,
+		inline:   append(slices.Clone(router.inline), middlewares...),
+	}
+}
+
+// Handle registers the handler for the given pattern, applying the
+// middlewares of With. Wildcards of the pattern may be constrained, ex.
+// "/articles/{id:int}"; requests with path values that do not satisfy the
+// constraint are not found. See RegisterConstraint for the constraints.
+func (router *Router) Handle(pattern string, handler http.Handler) {
+	router.handle(pattern, handler)
+	router.registry().routes = append(router.registry().routes, pattern)
+}
+
+// handle registers the handler without recording the route.
+func (router *Router) handle(pattern string, handler http.Handler) {
+	handler = router.applyInline(handler)
+	pattern, checks := parseConstraints(pattern)
+	if checks != nil {
+		handler = router.checkConstraints(checks, handler)
+	}
+	prefix := router.registry().fullPrefix()
+	router.ServeMux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setPattern(r, prefix, r.Pattern)
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// HandleFunc registers the handler function for the given pattern, applying
+// the middlewares of With.
+func (router *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	router.Handle(pattern, http.HandlerFunc(handler))
+}
+
 // All registers the handler for all methods on given pattern.
 func (router *Router) All(pattern string, handler http.HandlerFunc) {
 	methods := allMethods()
@@ -150,16 +330,30 @@ func (router *Router) CustomMethod(method, pattern string, handle http.HandlerFu
 }
 
 // ServeHTTP implements the http.Handler interface.
+// Requests for isolated groups bypass the middleware of the router.
 func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = router.renderScope(r)
+	var isolated *isolatedGroup
+	for i, group := range router.isolated {
+		if strings.HasPrefix(r.URL.Path, group.prefix+"/") &&
+			(isolated == nil || len(group.prefix) > len(isolated.prefix)) {
+			isolated = &router.isolated[i]
+		}
+	}
+	if isolated != nil {
+		isolated.handler.ServeHTTP(w, r)
+		return
+	}
 	router.chain.ServeHTTP(w, r)
 }
 
 // Static registers the handle to serve static files.
-func (router *Router) Static(pattern, dir string) {
+// Optional StaticOptions configure the file server, see StaticOptions.
+func (router *Router) Static(pattern, dir string, options ...StaticOptions) {
 	if !strings.HasSuffix(pattern, "/") {
 		pattern += "/"
 	}
-	router.Handle(pattern, http.StripPrefix(pattern, http.FileServer(http.Dir(dir))))
+	router.mount(pattern, newStaticHandler(router, pattern, dir, http.Dir(dir), options))
 }
 
 // StaticFS registers the handle to serve static files from FS filesystem.
@@ -167,11 +361,14 @@ func (router *Router) Static(pattern, dir string) {
 // //go:embded images
 // var content embed.FS
 // router.StaticFS("/images/", content) .
-func (router *Router) StaticFS(pattern string, fs fs.FS) {
+//
+// To serve a single page application with client side routing:
+// router.StaticFS("/", dist, mux.StaticOptions{SPA: true, SPAExclude: []string{"/api"}}) .
+func (router *Router) StaticFS(pattern string, fs fs.FS, options ...StaticOptions) {
 	if !strings.HasSuffix(pattern, "/") {
 		pattern += "/"
 	}
-	router.Handle(pattern, http.StripPrefix(pattern, http.FileServer(http.FS(fs))))
+	router.mount(pattern, newStaticHandler(router, pattern, "", http.FS(fs), options))
 }
 
 // ServeFile registers a ServeFile handler.
@@ -190,18 +387,170 @@ func (router *Router) ServeFileFS(pattern, file string, fs fs.FS) {
 
 // Run starts the HTTP server and logs any error that occurs.
 func (router *Router) Run(addr string) {
-	server := http.Server{
+	server := &http.Server{
 		Addr:              addr,
 		ReadHeaderTimeout: time.Second,
 		Handler:           router,
 	}
+	router.serverMu.Lock()
+	router.server = server
+	router.serverMu.Unlock()
 	slog.Info("Starting server:", "Address", addr)
 	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("Router.Run: failed to start server: ", "error", err)
 	}
 }
 
+// mount registers a handler for a subtree, such as static files or a proxy.
+// The root pattern is reserved for the not found handling of the router, so
+// a handler mounted at / is used as the fallback for requests that match no
+// other route.
+func (router *Router) mount(pattern string, handler http.Handler) {
+	if pattern != "/" {
+		router.Handle(pattern, handler)
+		return
+	}
+	handler = router.applyInline(handler)
+	router.registry().fallback = handler
+	router.registry().routes = append(router.registry().routes, pattern)
+}
+
+// applyInline wraps handler in the middlewares of With.
+func (router *Router) applyInline(handler http.Handler) http.Handler {
+	if router.registry().ordered {
+		for _, m := range slices.Backward(router.inline) {
+			handler = m(handler)
+		}
+		return handler
+	}
+	for _, m := range router.inline {
+		handler = m(handler)
+	}
+	return handler
+}
+
+// routeInfo records the full pattern of the route matching a request.
+type routeInfo struct {
+	pattern string
+}
+
+type routeKey struct{}
+
+// Pattern returns the pattern of the route that matched r including the
+// prefixes of enclosing groups, ex. "GET /api/users/{id}", or an empty
+// string if no route matched. Full patterns are tracked for requests that
+// passed a middleware needing them, such as Metrics, and for requests served
+// by an isolated group; otherwise Pattern returns r.Pattern.
+func Pattern(r *http.Request) string {
+	if info, ok := r.Context().Value(routeKey{}).(*routeInfo); ok {
+		return info.pattern
+	}
+	return r.Pattern
+}
+
+// trackPattern returns r with full pattern tracking enabled.
+func trackPattern(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(routeKey{}).(*routeInfo); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, &routeInfo{}))
+}
+
+// setPattern records pattern, registered on the router with the given full
+// prefix, as the route matching r. The prefix is taken from the router so
+// that the pattern is complete however deep in the chain tracking started.
+func setPattern(r *http.Request, prefix, pattern string) {
+	if info, ok := r.Context().Value(routeKey{}).(*routeInfo); ok {
+		info.pattern = joinPattern(prefix, pattern)
+	}
+}
+
+// joinPattern prefixes the path of pattern, keeping the method in front.
+func joinPattern(prefix, pattern string) string {
+	if pattern == "" {
+		return ""
+	}
+	method := ""
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 && !strings.Contains(pattern[:i], "/") {
+		method = pattern[:i] + " "
+		pattern = strings.TrimLeft(pattern[i:], " \t")
+	}
+	if strings.HasPrefix(pattern, "/") {
+		pattern = prefix + pattern
+	}
+	return method + pattern
+}
+
+// Shutdown gracefully shuts down the server started by Run. The router
+// reports draining first, which fails the readiness checks of Health, and
+// waits for the drain delay of Health so that load balancers stop sending
+// requests before the server stops accepting them.
+func (router *Router) Shutdown(ctx context.Context) error {
+	root := router.root()
+	root.draining.Store(true)
+	if root.drainDelay > 0 {
+		timer := time.NewTimer(root.drainDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	root.serverMu.Lock()
+	server := root.server
+	root.serverMu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
+// Draining reports whether Shutdown was called.
+func (router *Router) Draining() bool {
+	return router.root().draining.Load()
+}
+
+// root returns the top level router of groups and With routers.
+func (router *Router) root() *Router {
+	for {
+		switch {
+		case router.base != nil:
+			router = router.base
+		case router.parent != nil:
+			router = router.parent
+		default:
+			return router
+		}
+	}
+}
+
+// registry returns the router that holds the routes registered on router,
+// which is the base router for With routers.
+func (router *Router) registry() *Router {
+	if router.base != nil {
+		return router.base
+	}
+	return router
+}
+
+// Routes returns the full patterns of the routes registered on the router
+// and its groups, in registration order, ex. "GET /api/users/{id}".
+func (router *Router) Routes() []string {
+	router = router.registry()
+	routes := make([]string, 0, len(router.routes))
+	for _, route := range router.routes {
+		routes = append(routes, joinPattern("", route))
+	}
+	for _, group := range router.groups {
+		for _, route := range group.Routes() {
+			routes = append(routes, joinPattern(group.prefix, route))
+		}
+	}
+	return routes
+}
+
 func (router *Router) addMethod(method string) {
+	router = router.registry()
 	if !slices.Contains(router.methods, method) {
 		router.methods = append(router.methods, method)
 	}
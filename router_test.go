@@ -427,6 +427,65 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestGroupErrorHandlers(t *testing.T) {
+	router := NewRouter()
+	api := router.Group("/api")
+	api.Post("/users", func(http.ResponseWriter, *http.Request) {})
+	router.Group("/pages")
+	// handlers set after the groups were created are inherited
+	router.NotFound(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<h1>Not Found</h1>")
+	})
+	api.NotFound(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"not found"}`)
+	}).NotAllowed(func(w http.ResponseWriter, _ string, code int) {
+		w.WriteHeader(code)
+		io.WriteString(w, `{"error":"method not allowed"}`)
+	})
+
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/missing", "<h1>Not Found</h1>", http.StatusNotFound},
+		{http.MethodGet, "/pages/missing", "<h1>Not Found</h1>", http.StatusNotFound},
+		{http.MethodGet, "/api/missing", `{"error":"not found"}`, http.StatusNotFound},
+		{http.MethodGet, "/api/users", `{"error":"method not allowed"}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Error("expected", tt.status, tt.body, "got", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	var method string
+	var allowed []string
+	router := NewRouter().MethodNotAllowed(
+		func(w http.ResponseWriter, r *http.Request, methods []string) {
+			method, allowed = r.Method, methods
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		})
+	router.Get("/item", func(http.ResponseWriter, *http.Request) {})
+	router.Put("/item", func(http.ResponseWriter, *http.Request) {})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/item", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("expected", http.StatusMethodNotAllowed, "got", w.Code)
+	}
+	if method != http.MethodDelete || strings.Join(allowed, ", ") != "GET, HEAD, PUT" {
+		t.Error("expected", http.MethodDelete, "GET, HEAD, PUT", "got", method, allowed)
+	}
+	if w.Header().Get("Allow") != "GET, HEAD, PUT" {
+		t.Errorf("Expected 'GET, HEAD, PUT', got '%s'", w.Header().Get("Allow"))
+	}
+}
+
 func TestCustomMethod(t *testing.T) {
 	router := NewRouter()
 	router.CustomMethod("UPDATE", "/{$}", func(w http.ResponseWriter, _ *http.Request) {
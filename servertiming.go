@@ -0,0 +1,214 @@
+package mux
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const serverTimingHeader = "Server-Timing"
+
+// Timing is a named metric of the Server-Timing header.
+type Timing struct {
+	Name        string
+	Duration    time.Duration
+	Description string
+}
+
+// String formats the metric for the Server-Timing header.
+func (t Timing) String() string {
+	var b strings.Builder
+	b.WriteString(timingName(t.Name))
+	b.WriteString(";dur=")
+	b.WriteString(strconv.FormatFloat(float64(t.Duration.Microseconds())/1000, 'f', -1, 64))
+	if t.Description != "" {
+		b.WriteString(`;desc="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(t.Description))
+		b.WriteString(`"`)
+	}
+	return b.String()
+}
+
+// timingName replaces characters that are not allowed in a token.
+func timingName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r > ' ' && r < 0x7f && !strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+type timingKey struct{}
+
+// timings collects the metrics of a request.
+type timings struct {
+	mu      sync.Mutex
+	metrics []Timing
+}
+
+func (t *timings) add(timing Timing) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics = append(t.metrics, timing)
+}
+
+func (t *timings) list() []Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Timing(nil), t.metrics...)
+}
+
+// withTimings returns r with a metric collector, reusing an existing one.
+func withTimings(r *http.Request) (*http.Request, *timings) {
+	if t, ok := r.Context().Value(timingKey{}).(*timings); ok {
+		return r, t
+	}
+	t := &timings{}
+	return r.WithContext(context.WithValue(r.Context(), timingKey{}, t)), t
+}
+
+// AddTiming records a metric for the Server-Timing header of the request.
+// It does nothing if the request did not pass the ServerTiming or Logger
+// middleware.
+func AddTiming(ctx context.Context, name string, duration time.Duration, description string) {
+	if t, ok := ctx.Value(timingKey{}).(*timings); ok {
+		t.add(Timing{Name: name, Duration: duration, Description: description})
+	}
+}
+
+// StartTiming starts measuring a metric and returns a function that records
+// it, ex.
+// defer mux.StartTiming(r.Context(), "db")() .
+func StartTiming(ctx context.Context, name string) func() {
+	start := time.Now()
+	return func() {
+		AddTiming(ctx, name, time.Since(start), "")
+	}
+}
+
+// Timings returns the metrics recorded for the request.
+func Timings(ctx context.Context) []Timing {
+	if t, ok := ctx.Value(timingKey{}).(*timings); ok {
+		return t.list()
+	}
+	return nil
+}
+
+// ServerTimingOptions configures ServerTiming.
+type ServerTimingOptions struct {
+	// Trusted decides whether the metrics are sent to the client. Metrics
+	// reveal internals of the application, so they should only be sent to
+	// trusted clients. All clients are trusted when nil.
+	Trusted func(*http.Request) bool
+}
+
+// ServerTiming is a middleware that sends the metrics recorded with
+// AddTiming and StartTiming in the Server-Timing response header, together
+// with a total metric for the time until the response started. Metrics
+// recorded after the response was flushed by a streaming handler are sent
+// as an HTTP trailer.
+func ServerTiming(options ServerTimingOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, collected := withTimings(r)
+			if options.Trusted != nil && !options.Trusted(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tw := &timingWriter{ResponseWriter: w, timings: collected, start: time.Now()}
+			next.ServeHTTP(tw, r)
+			tw.finish()
+		})
+	}
+}
+
+// timingWriter writes the Server-Timing header before the response starts.
+type timingWriter struct {
+	http.ResponseWriter
+
+	timings  *timings
+	start    time.Time
+	sent     int
+	wrote    bool
+	streamed bool
+	hijacked bool
+}
+
+// WriteHeader adds the Server-Timing header.
+func (tw *timingWriter) WriteHeader(code int) {
+	if !tw.wrote {
+		tw.wrote = true
+		metrics := tw.timings.list()
+		tw.sent = len(metrics)
+		metrics = append(metrics, Timing{Name: "total", Duration: time.Since(tw.start)})
+		tw.Header().Set(serverTimingHeader, formatTimings(metrics))
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+// Write adds the Server-Timing header before writing the body.
+func (tw *timingWriter) Write(b []byte) (int, error) {
+	if !tw.wrote {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flush marks the response as streamed.
+func (tw *timingWriter) Flush() {
+	if !tw.wrote {
+		tw.WriteHeader(http.StatusOK)
+	}
+	tw.streamed = true
+	http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+// Hijack takes over the connection, ex. for WebSocket. No metrics are sent
+// for a hijacked connection.
+func (tw *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(tw.ResponseWriter).Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// finish sends the header for empty responses, or the metrics recorded after
+// the header of a streamed response as a trailer.
+func (tw *timingWriter) finish() {
+	if tw.hijacked {
+		return
+	}
+	if !tw.wrote {
+		tw.WriteHeader(http.StatusOK)
+		return
+	}
+	metrics := tw.timings.list()
+	if !tw.streamed || len(metrics) <= tw.sent {
+		return
+	}
+	tw.Header().Set(http.TrailerPrefix+serverTimingHeader, formatTimings(metrics[tw.sent:]))
+}
+
+func formatTimings(metrics []Timing) string {
+	parts := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		parts = append(parts, metric.String())
+	}
+	return strings.Join(parts, ", ")
+}
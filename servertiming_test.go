@@ -0,0 +1,78 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerTiming(t *testing.T) {
+	router := NewRouter(ServerTiming(ServerTimingOptions{
+		Trusted: func(r *http.Request) bool { return r.Header.Get("X-Trusted") != "" },
+	}))
+	router.Get("/page", func(w http.ResponseWriter, r *http.Request) {
+		AddTiming(r.Context(), "db", 12500*time.Microsecond, `users "query"`)
+		stop := StartTiming(r.Context(), "cache")
+		stop()
+		io.WriteString(w, "page")
+	})
+	router.Get("/stream", func(w http.ResponseWriter, r *http.Request) {
+		AddTiming(r.Context(), "db", time.Millisecond, "")
+		io.WriteString(w, "chunk")
+		http.NewResponseController(w).Flush()
+		AddTiming(r.Context(), "render", 2*time.Millisecond, "")
+	})
+
+	t.Run("header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/page", nil)
+		req.Header.Set("X-Trusted", "1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		header := w.Header().Get("Server-Timing")
+		for _, want := range []string{`db;dur=12.5;desc="users \"query\""`, "cache;dur=", "total;dur="} {
+			if !strings.Contains(header, want) {
+				t.Errorf("Expected '%s' in '%s'", want, header)
+			}
+		}
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+		if w.Header().Get("Server-Timing") != "" {
+			t.Error("expected no Server-Timing header, got", w.Header().Get("Server-Timing"))
+		}
+	})
+
+	t.Run("trailer", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+		req.Header.Set("X-Trusted", "1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		resp := w.Result()
+		if !strings.HasPrefix(resp.Header.Get("Server-Timing"), "db;dur=1") {
+			t.Error("wrong header", resp.Header.Get("Server-Timing"))
+		}
+		if resp.Trailer.Get("Server-Timing") != "render;dur=2" {
+			t.Error("wrong trailer", resp.Trailer.Get("Server-Timing"))
+		}
+	})
+}
+
+func TestLoggerTimings(t *testing.T) {
+	buf := new(bytes.Buffer)
+	slog.SetDefault(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{})))
+	router := NewRouter(Logger)
+	router.Get("/", func(_ http.ResponseWriter, r *http.Request) {
+		AddTiming(r.Context(), "db", 3*time.Millisecond, "")
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(buf.String(), "db;dur=3") {
+		t.Error("expected timing in log, got", buf.String())
+	}
+}
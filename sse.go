@@ -0,0 +1,388 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHeartbeat = 15 * time.Second
+	defaultHubBuffer = 16
+)
+
+var (
+	// ErrStreamClosed is returned by EventStream.Send after the handler of
+	// the stream returned.
+	ErrStreamClosed = errors.New("mux: event stream closed")
+	// ErrSlowSubscriber is returned by Hub.Serve when the subscriber was
+	// evicted because it did not keep up with the published events.
+	ErrSlowSubscriber = errors.New("mux: subscriber too slow")
+)
+
+// Event is a server-sent event.
+type Event struct {
+	// ID is stored by the client and sent back in the Last-Event-ID header
+	// when it reconnects.
+	ID string
+	// Name is the event type; clients receive unnamed events as "message".
+	Name string
+	// Data is the payload; it may span several lines.
+	Data string
+	// Retry asks the client to wait this long before reconnecting.
+	Retry time.Duration
+}
+
+// SSEOptions configures the handler registered by SSEWithOptions.
+type SSEOptions struct {
+	// Heartbeat is the interval of the comments sent to keep idle
+	// connections open through proxies. Defaults to 15 seconds, a negative
+	// value disables heartbeats.
+	Heartbeat time.Duration
+	// Retry is sent at the start of the stream as the reconnection delay of
+	// the client.
+	Retry time.Duration
+}
+
+// EventStream writes server-sent events to a client. It is safe for
+// concurrent use.
+type EventStream struct {
+	r           *http.Request
+	w           http.ResponseWriter
+	controller  *http.ResponseController
+	lastEventID string
+	retry       time.Duration
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+}
+
+// SSE registers a GET handler streaming server-sent events. The handler runs
+// for the lifetime of the connection and should return when ctx is done,
+// ex.
+//
+//	router.SSE("/events", func(ctx context.Context, stream *mux.EventStream) error {
+//		for {
+//			select {
+//			case <-ctx.Done():
+//				return nil
+//			case price := <-prices:
+//				if err := stream.Send(mux.Event{Name: "price", Data: price}); err != nil {
+//					return err
+//				}
+//			}
+//		}
+//	})
+//
+// The response starts with the first event or heartbeat, so an error
+// returned before is rendered like with Error; later errors are logged.
+// Hub.Serve can be used as handler to broadcast events.
+func (router *Router) SSE(pattern string,
+	handler func(ctx context.Context, stream *EventStream) error,
+) {
+	router.SSEWithOptions(pattern, SSEOptions{}, handler)
+}
+
+// SSEWithOptions registers a handler streaming server-sent events like SSE.
+func (router *Router) SSEWithOptions(pattern string, options SSEOptions,
+	handler func(ctx context.Context, stream *EventStream) error,
+) {
+	if options.Heartbeat == 0 {
+		options.Heartbeat = defaultHeartbeat
+	}
+	router.Get(pattern, func(w http.ResponseWriter, r *http.Request) {
+		stream := &EventStream{
+			r:           r,
+			w:           w,
+			controller:  http.NewResponseController(w),
+			lastEventID: r.Header.Get("Last-Event-ID"),
+			retry:       options.Retry,
+		}
+		ctx, cancel := context.WithCancel(r.Context())
+		heartbeat := make(chan struct{})
+		if options.Heartbeat > 0 {
+			go stream.heartbeat(ctx, options.Heartbeat, heartbeat)
+		} else {
+			close(heartbeat)
+		}
+		err := handler(ctx, stream)
+		cancel()
+		<-heartbeat
+		started := stream.close()
+		switch {
+		case err == nil, errors.Is(err, context.Canceled):
+		case !started:
+			Error(w, r, err)
+		default:
+			slog.Error("mux.SSE: stream failed", "path", r.URL.Path, "error", err)
+		}
+	})
+}
+
+// heartbeat sends a comment every interval until ctx is done.
+func (s *EventStream) heartbeat(ctx context.Context, interval time.Duration,
+	done chan struct{},
+) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Comment("heartbeat"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Request returns the request of the stream, ex. for its path values.
+func (s *EventStream) Request() *http.Request {
+	return s.r
+}
+
+// LastEventID returns the ID of the last event received by a reconnecting
+// client, or an empty string for a new client.
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Send writes the event and flushes it to the client.
+func (s *EventStream) Send(event Event) error {
+	if strings.ContainsAny(event.ID, "\r\n\x00") || strings.ContainsAny(event.Name, "\r\n") {
+		return errors.New("mux: event id and name must be a single line")
+	}
+	var b strings.Builder
+	if event.ID != "" {
+		b.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Name != "" {
+		b.WriteString("event: " + event.Name + "\n")
+	}
+	if event.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+	data := strings.ReplaceAll(event.Data, "\r\n", "\n")
+	for line := range strings.SplitSeq(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Comment writes a comment, which clients ignore.
+func (s *EventStream) Comment(text string) error {
+	var b strings.Builder
+	for line := range strings.SplitSeq(text, "\n") {
+		b.WriteString(": " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// write starts the response if needed, then writes and flushes message.
+func (s *EventStream) write(message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if !s.started {
+		s.started = true
+		header := s.w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("X-Accel-Buffering", "no")
+		header.Del("Content-Length")
+		// streams outlive the write timeout of the server
+		s.controller.SetWriteDeadline(time.Time{})
+		s.w.WriteHeader(http.StatusOK)
+		if s.retry > 0 {
+			message = "retry: " + strconv.FormatInt(s.retry.Milliseconds(), 10) + "\n\n" +
+				message
+		}
+	}
+	if _, err := s.w.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := s.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// close prevents further writes and reports whether the response started.
+func (s *EventStream) close() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.started
+}
+
+// HubOptions configures a Hub.
+type HubOptions struct {
+	// Buffer is the number of events queued for each subscriber. Subscribers
+	// with a full queue are evicted. Defaults to 16.
+	Buffer int
+	// History is the number of recent events kept to replay to clients
+	// resuming with a Last-Event-ID.
+	History int
+}
+
+// Hub broadcasts events to many event streams, ex.
+//
+//	hub := mux.NewHub(mux.HubOptions{History: 100})
+//	router.SSE("/events", hub.Serve)
+//	hub.Publish(mux.Event{Name: "update", Data: "42"})
+type Hub struct {
+	options HubOptions
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	history     []Event
+	nextID      uint64
+	closed      bool
+}
+
+type subscriber struct {
+	events  chan Event
+	evicted chan struct{}
+}
+
+// NewHub returns a Hub.
+func NewHub(options ...HubOptions) *Hub {
+	hub := &Hub{subscribers: map[*subscriber]struct{}{}}
+	if len(options) > 0 {
+		hub.options = options[0]
+	}
+	if hub.options.Buffer <= 0 {
+		hub.options.Buffer = defaultHubBuffer
+	}
+	return hub
+}
+
+// Publish sends the event to all subscribers without blocking. Events
+// without an ID are numbered when the hub keeps a history, so that clients
+// can resume.
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	if h.options.History > 0 {
+		if event.ID == "" {
+			h.nextID++
+			event.ID = strconv.FormatUint(h.nextID, 10)
+		}
+		h.history = append(h.history, event)
+		if len(h.history) > h.options.History {
+			h.history = h.history[len(h.history)-h.options.History:]
+		}
+	}
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.evicted)
+		}
+	}
+}
+
+// Serve subscribes stream to the hub and sends it the published events until
+// ctx is done, the subscriber is evicted or the hub is closed. Events
+// published after the LastEventID of the stream are replayed first.
+// Closing the hub ends the stream normally; streams subscribing after Close
+// end immediately without events.
+func (h *Hub) Serve(ctx context.Context, stream *EventStream) error {
+	sub, missed := h.subscribe(stream.LastEventID())
+	if sub == nil {
+		return nil
+	}
+	defer h.unsubscribe(sub)
+	for _, event := range missed {
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-sub.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-sub.evicted:
+			h.mu.Lock()
+			closed := h.closed
+			h.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return ErrSlowSubscriber
+		}
+	}
+}
+
+// subscribe adds a subscriber and returns the events of the history after
+// lastEventID, or the whole history if the ID is unknown. The subscriber is
+// nil if the hub was closed.
+func (h *Hub) subscribe(lastEventID string) (*subscriber, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, nil
+	}
+	sub := &subscriber{
+		events:  make(chan Event, h.options.Buffer),
+		evicted: make(chan struct{}),
+	}
+	h.subscribers[sub] = struct{}{}
+	if lastEventID == "" {
+		return sub, nil
+	}
+	missed := h.history
+	for i, event := range h.history {
+		if event.ID == lastEventID {
+			missed = h.history[i+1:]
+		}
+	}
+	return sub, append([]Event(nil), missed...)
+}
+
+func (h *Hub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, sub)
+}
+
+// Subscribers returns the number of subscribed streams.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// Close ends Serve for all subscribers and drops later events.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.evicted)
+	}
+}
@@ -0,0 +1,153 @@
+package mux
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	router := NewRouter()
+	router.SSEWithOptions("/events", SSEOptions{Retry: 3 * time.Second},
+		func(_ context.Context, stream *EventStream) error {
+			err := stream.Send(Event{ID: "7", Name: "greeting", Data: "hello\nworld"})
+			if err != nil {
+				return err
+			}
+			return stream.Send(Event{Data: "resumed after " + stream.LastEventID()})
+		})
+	router.SSE("/private/{topic}", func(_ context.Context, stream *EventStream) error {
+		if stream.Request().PathValue("topic") != "public" {
+			return &HTTPError{Status: http.StatusForbidden}
+		}
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Last-Event-ID", "6")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	want := "retry: 3000\n\nid: 7\nevent: greeting\ndata: hello\ndata: world\n\n" +
+		"data: resumed after 6\n\n"
+	if w.Body.String() != want || !w.Flushed ||
+		w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected '%s', got '%s'", want, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/private/secret", nil))
+	if w.Code != http.StatusForbidden {
+		t.Error("expected", http.StatusForbidden, "got", w.Code)
+	}
+}
+
+func TestSSEHeartbeat(t *testing.T) {
+	var stream *EventStream
+	router := NewRouter()
+	router.SSEWithOptions("/events", SSEOptions{Heartbeat: 5 * time.Millisecond},
+		func(ctx context.Context, s *EventStream) error {
+			stream = s
+			time.Sleep(30 * time.Millisecond)
+			return nil
+		})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if !strings.HasPrefix(w.Body.String(), ": heartbeat\n\n") {
+		t.Errorf("Expected ': heartbeat', got '%s'", w.Body.String())
+	}
+	if err := stream.Send(Event{Data: "late"}); err != ErrStreamClosed {
+		t.Error("expected", ErrStreamClosed, "got", err)
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub(HubOptions{History: 10})
+	router := NewRouter(Logger)
+	router.SSE("/events", hub.Serve)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	read := func(lastEventID string, events int) []string {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var lines []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if scanner.Text() == "" {
+				if events--; events == 0 {
+					break
+				}
+				continue
+			}
+			lines = append(lines, scanner.Text())
+		}
+		return lines
+	}
+
+	done := make(chan []string)
+	go func() { done <- read("", 2) }()
+	for hub.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	hub.Publish(Event{Name: "update", Data: "a"})
+	hub.Publish(Event{Data: "b"})
+	got := strings.Join(<-done, "|")
+	if want := "id: 1|event: update|data: a|id: 2|data: b"; got != want {
+		t.Errorf("Expected '%s', got '%s'", want, got)
+	}
+
+	got = strings.Join(read("1", 1), "|")
+	if want := "id: 2|data: b"; got != want {
+		t.Errorf("Expected '%s', got '%s'", want, got)
+	}
+}
+
+func TestHubEviction(t *testing.T) {
+	hub := NewHub(HubOptions{Buffer: 1})
+	slow, _ := hub.subscribe("")
+	hub.Publish(Event{Data: "1"})
+	hub.Publish(Event{Data: "2"})
+	select {
+	case <-slow.evicted:
+	default:
+		t.Error("expected slow subscriber to be evicted")
+	}
+	if hub.Subscribers() != 0 {
+		t.Error("expected", 0, "got", hub.Subscribers())
+	}
+
+	errs := make(chan error, 2)
+	router := NewRouter()
+	router.SSE("/events", func(ctx context.Context, stream *EventStream) error {
+		err := hub.Serve(ctx, stream)
+		errs <- err
+		return err
+	})
+	go router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+	for hub.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	hub.Close()
+	if err := <-errs; err != nil {
+		t.Error("expected", nil, "got", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if err := <-errs; err != nil || w.Code != http.StatusOK || w.Body.String() != "" {
+		t.Error("expected empty stream after close, got", err, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,306 @@
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const defaultIndex = "index.html"
+
+// StaticOptions configures the handler registered by Static and StaticFS.
+// The zero value serves files and directory listings like http.FileServer,
+// with missing files answered by the not found handler of the router.
+type StaticOptions struct {
+	// SPA enables single page application mode: unknown paths under the
+	// pattern are answered with SPAIndex so client side routes resolve.
+	// Missing assets (paths with a file extension) still return not found.
+	SPA bool
+	// SPAIndex is the application shell served in SPA mode.
+	// Defaults to index.html.
+	SPAIndex string
+	// SPAExclude lists request path prefixes, such as /api, that are never
+	// answered with the application shell.
+	SPAExclude []string
+	// DisableListing answers requests for directories without an index file
+	// with not found instead of a directory listing.
+	DisableListing bool
+	// Browse renders directory listings with ListingTemplate, including
+	// sizes, modification times, sorting and breadcrumbs. Requests that
+	// accept application/json get the listing as JSON.
+	Browse bool
+	// ListingTemplate renders Browse listings; it is executed with a Listing.
+	// Defaults to DefaultListingTemplate.
+	ListingTemplate *template.Template
+	// HideDotfiles answers requests for files or directories whose name
+	// starts with a dot, such as .git or .env, with not found and omits
+	// them from directory listings.
+	HideDotfiles bool
+	// NoSymlinkEscape refuses to serve symlinks that resolve outside of the
+	// served directory. It only applies to Static.
+	NoSymlinkEscape bool
+	// IndexFiles are the file names served for a directory, in order of
+	// preference. Defaults to index.html.
+	IndexFiles []string
+	// Headers are added to responses by file extension, ex. ".js".
+	Headers map[string]http.Header
+	// MIMETypes override the Content-Type by file extension, ex. ".mjs".
+	MIMETypes map[string]string
+}
+
+// staticHandler serves files from a http.FileSystem mounted at prefix.
+type staticHandler struct {
+	router  *Router
+	prefix  string
+	dir     string
+	root    http.FileSystem
+	options StaticOptions
+}
+
+func newStaticHandler(router *Router, prefix, dir string, root http.FileSystem,
+	options []StaticOptions,
+) http.Handler {
+	handler := &staticHandler{
+		router: router,
+		prefix: prefix,
+		dir:    dir,
+		root:   root,
+	}
+	if len(options) > 0 {
+		handler.options = options[0]
+	}
+	if handler.options.SPAIndex == "" {
+		handler.options.SPAIndex = defaultIndex
+	}
+	if len(handler.options.IndexFiles) == 0 {
+		handler.options.IndexFiles = []string{defaultIndex}
+	}
+	// Copy the maps so that later changes by the caller do not race with
+	// requests.
+	headers := make(map[string]http.Header, len(handler.options.Headers))
+	for ext, header := range handler.options.Headers {
+		headers[ext] = header.Clone()
+	}
+	handler.options.Headers = headers
+	handler.options.MIMETypes = maps.Clone(handler.options.MIMETypes)
+	return handler
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, s.prefix) {
+		s.router.notFoundHandler()(w, r)
+		return
+	}
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, s.prefix))
+	if s.options.SPA && (name == "/" || name == "/"+s.options.SPAIndex) {
+		s.serveShell(w, r)
+		return
+	}
+	file, info, err := s.open(name)
+	if err != nil {
+		if s.options.SPA && errors.Is(err, fs.ErrNotExist) &&
+			path.Ext(name) == "" && !s.excluded(r.URL.Path) {
+			s.serveShell(w, r)
+			return
+		}
+		s.serveError(w, r, err)
+		return
+	}
+	defer file.Close()
+	if info.IsDir() {
+		s.serveDir(w, r, name, file)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		localRedirect(w, r, "../"+info.Name())
+		return
+	}
+	s.serveFile(w, r, name, file, info)
+}
+
+// open opens name and applies the dotfile and symlink restrictions.
+func (s *staticHandler) open(name string) (http.File, fs.FileInfo, error) {
+	if s.options.HideDotfiles && isDotPath(name) {
+		return nil, nil, fs.ErrNotExist
+	}
+	if s.options.NoSymlinkEscape && s.dir != "" && s.escapes(name) {
+		return nil, nil, fs.ErrNotExist
+	}
+	file, err := s.root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// escapes reports whether name resolves to a location outside of the
+// served directory. Missing files do not escape.
+func (s *staticHandler) escapes(name string) bool {
+	root, err := filepath.EvalSymlinks(s.dir)
+	if err != nil {
+		return true
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, target)
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (s *staticHandler) serveDir(w http.ResponseWriter, r *http.Request, name string,
+	dir http.File,
+) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		localRedirect(w, r, path.Base(r.URL.Path)+"/")
+		return
+	}
+	for _, index := range s.options.IndexFiles {
+		if s.serveIndex(w, r, path.Join(name, index)) {
+			return
+		}
+	}
+	if s.options.DisableListing {
+		s.router.notFoundHandler()(w, r)
+		return
+	}
+	entries, err := dir.Readdir(-1)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	if s.options.HideDotfiles {
+		entries = slices.DeleteFunc(entries, func(entry fs.FileInfo) bool {
+			return strings.HasPrefix(entry.Name(), ".")
+		})
+	}
+	if s.options.Browse {
+		s.serveListing(w, r, name, entries)
+		return
+	}
+	dirList(w, entries)
+}
+
+// serveIndex serves the index file name if it exists and reports whether it did.
+func (s *staticHandler) serveIndex(w http.ResponseWriter, r *http.Request, name string) bool {
+	file, info, err := s.open(name)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	if info.IsDir() {
+		return false
+	}
+	s.serveFile(w, r, name, file, info)
+	return true
+}
+
+func (s *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string,
+	file http.File, info fs.FileInfo,
+) {
+	ext := path.Ext(name)
+	for key, values := range s.options.Headers[ext] {
+		w.Header()[http.CanonicalHeaderKey(key)] = slices.Clone(values)
+	}
+	if mime, ok := s.options.MIMETypes[ext]; ok {
+		w.Header().Set("Content-Type", mime)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// serveShell serves the SPA index. The shell must always be revalidated so
+// that clients pick up new asset references after a deploy.
+func (s *staticHandler) serveShell(w http.ResponseWriter, r *http.Request) {
+	name := "/" + s.options.SPAIndex
+	file, info, err := s.open(name)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	defer file.Close()
+	if info.IsDir() {
+		s.router.notFoundHandler()(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	s.serveFile(w, r, name, file, info)
+}
+
+// serveError routes missing and forbidden files to the not found handler of
+// the router so that the existence of protected files is not revealed.
+func (s *staticHandler) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		s.router.notFoundHandler()(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError),
+		http.StatusInternalServerError)
+}
+
+func (s *staticHandler) excluded(urlPath string) bool {
+	for _, prefix := range s.options.SPAExclude {
+		if urlPath == prefix || strings.HasPrefix(urlPath, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isDotPath(name string) bool {
+	for part := range strings.SplitSeq(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+var htmlReplacer = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&#34;",
+	"'", "&#39;",
+)
+
+// dirList writes a directory listing in the format used by http.FileServer.
+func dirList(w http.ResponseWriter, entries []fs.FileInfo) {
+	slices.SortFunc(entries, func(a, b fs.FileInfo) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", link.String(), htmlReplacer.Replace(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// localRedirect redirects to a path relative to the request, keeping the query.
+func localRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
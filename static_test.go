@@ -0,0 +1,167 @@
+package mux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func spaFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":     {Data: []byte("<html>shell</html>")},
+		"assets/app.js":  {Data: []byte("console.log('app')")},
+		"assets/app.css": {Data: []byte("body{}")},
+	}
+}
+
+func TestStaticFSSPA(t *testing.T) {
+	router := NewRouter().NotFound(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "custom not found")
+	})
+	router.StaticFS("/", spaFS(), StaticOptions{SPA: true, SPAExclude: []string{"/api"}})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+		cache  string
+	}{
+		{"root", "/", http.StatusOK, "<html>shell</html>", "no-cache"},
+		{"clientRoute", "/app/settings", http.StatusOK, "<html>shell</html>", "no-cache"},
+		{"asset", "/assets/app.js", http.StatusOK, "console.log('app')", ""},
+		{"missingAsset", "/assets/missing.js", http.StatusNotFound, "custom not found", ""},
+		{"excluded", "/api/users", http.StatusNotFound, "custom not found", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Error("expected", tt.status, "got", w.Code)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("Expected '%s', got '%s'", tt.body, w.Body.String())
+			}
+			if w.Header().Get("Cache-Control") != tt.cache {
+				t.Errorf("Expected cache control '%s', got '%s'",
+					tt.cache, w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestStaticFSSPAGroup(t *testing.T) {
+	router := NewRouter()
+	app := router.Group("/app")
+	app.StaticFS("/ui", spaFS(), StaticOptions{SPA: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/app/ui/users/42", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "<html>shell</html>" {
+		t.Error("expected shell, got", w.Code, w.Body.String())
+	}
+}
+
+func TestStaticOptions(t *testing.T) {
+	files := fstest.MapFS{
+		".env":             {Data: []byte("SECRET=1")},
+		".git/config":      {Data: []byte("[core]")},
+		"docs/readme.txt":  {Data: []byte("readme")},
+		"site/default.htm": {Data: []byte("default page")},
+		"app.mjs":          {Data: []byte("export {}")},
+		"app.js":           {Data: []byte("let a")},
+	}
+	router := NewRouter().NotFound(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "custom not found")
+	})
+	router.StaticFS("/files", files, StaticOptions{
+		DisableListing: true,
+		HideDotfiles:   true,
+		IndexFiles:     []string{"index.html", "default.htm"},
+		Headers: map[string]http.Header{
+			".js": {"Cache-Control": {"max-age=3600"}},
+		},
+		MIMETypes: map[string]string{".mjs": "text/javascript"},
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+	}{
+		{"listing", "/files/docs/", http.StatusNotFound, "custom not found"},
+		{"dotfile", "/files/.env", http.StatusNotFound, "custom not found"},
+		{"dotdir", "/files/.git/config", http.StatusNotFound, "custom not found"},
+		{"missing", "/files/missing.txt", http.StatusNotFound, "custom not found"},
+		{"index", "/files/site/", http.StatusOK, "default page"},
+		{"file", "/files/docs/readme.txt", http.StatusOK, "readme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Error("expected", tt.status, "got", w.Code)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("Expected '%s', got '%s'", tt.body, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/files/app.js", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Header().Get("Cache-Control") != "max-age=3600" {
+			t.Error("wrong cache control", w.Header().Get("Cache-Control"))
+		}
+		req = httptest.NewRequest(http.MethodGet, "/files/app.mjs", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Header().Get("Content-Type") != "text/javascript" {
+			t.Error("wrong content type", w.Header().Get("Content-Type"))
+		}
+	})
+}
+
+func TestStaticSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "public.txt"), []byte("public"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(dir, "secret.txt")); err != nil {
+		t.Skip("symlinks not supported", err)
+	}
+	router := NewRouter()
+	router.Static("/files", dir, StaticOptions{NoSymlinkEscape: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/files/secret.txt", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Error("expected", http.StatusNotFound, "got", w.Code)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/files/public.txt", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Body.String() != "public" {
+		t.Errorf("Expected 'public', got '%s'", w.Body.String())
+	}
+}
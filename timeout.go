@@ -0,0 +1,252 @@
+package mux
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeoutGrace is added to the connection write deadline so that the
+// timeout response can still be written when the handler times out.
+const timeoutGrace = time.Second
+
+type timeoutKey struct{}
+
+// TimeoutOptions configures RequestTimeout.
+type TimeoutOptions struct {
+	// Timeout is the time a handler may take before the request context
+	// is cancelled.
+	Timeout time.Duration
+	// Status is sent if the handler has not written a response when the
+	// timeout expires. Defaults to 503 Service Unavailable, use 504 Gateway
+	// Timeout for proxying handlers.
+	Status int
+	// OnError renders the timeout response. Defaults to the error renderer of
+	// the router.
+	OnError ErrorFunc
+}
+
+// Timeout is a middleware that cancels the request context after d.
+// See RequestTimeout.
+func Timeout(d time.Duration) Middleware {
+	return RequestTimeout(TimeoutOptions{Timeout: d})
+}
+
+// RequestTimeout is a middleware that sets a deadline on the request context.
+// If the handler has not written a response when the deadline expires the
+// timeout response is sent and later writes of the handler fail with
+// http.ErrHandlerTimeout. Unlike http.TimeoutHandler the response is not
+// buffered: once the handler has written, streaming continues and every
+// Flush extends the deadline, including the write deadline of the
+// connection, by Timeout.
+//
+// The timeout set closest to the route wins, so a timeout for a Group or a
+// route registered using With replaces the timeout of the router, ex.
+// router.Use(mux.Timeout(5 * time.Second))
+// router.With(mux.Timeout(time.Minute)).Get("/report", report) .
+func RequestTimeout(options TimeoutOptions) Middleware {
+	if options.Status == 0 {
+		options.Status = http.StatusServiceUnavailable
+	}
+	if options.OnError == nil {
+		options.OnError = defaultError
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tw, ok := r.Context().Value(timeoutKey{}).(*timeoutWriter); ok {
+				tw.reset(options)
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithCancelCause(r.Context())
+			defer cancel(nil)
+			tw := &timeoutWriter{
+				ResponseWriter: w,
+				controller:     http.NewResponseController(w),
+				header:         http.Header{},
+				start:          time.Now(),
+				options:        options,
+			}
+			tctx := &timeoutContext{Context: ctx, writer: tw}
+			r = r.WithContext(context.WithValue(tctx, timeoutKey{}, tw))
+			tw.request = r
+			tw.mu.Lock()
+			tw.deadline = tw.start.Add(options.Timeout)
+			tw.timer = time.AfterFunc(options.Timeout, func() {
+				if tw.expire() {
+					cancel(context.DeadlineExceeded)
+				}
+			})
+			tw.extendWrite()
+			tw.mu.Unlock()
+			defer tw.stop()
+			next.ServeHTTP(tw, r)
+		})
+	}
+}
+
+// timeoutContext reports the current deadline of the timeoutWriter, which
+// moves when a streaming handler flushes.
+type timeoutContext struct {
+	context.Context
+
+	writer *timeoutWriter
+}
+
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	c.writer.mu.Lock()
+	defer c.writer.mu.Unlock()
+	return c.writer.deadline, true
+}
+
+func (c *timeoutContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// timeoutWriter serializes writes of the handler with the timeout response.
+// Headers are kept separately until the handler writes, so that the timeout
+// response does not race with the handler setting headers.
+type timeoutWriter struct {
+	http.ResponseWriter
+
+	controller *http.ResponseController
+	request    *http.Request
+	start      time.Time
+	options    TimeoutOptions
+
+	mu       sync.Mutex
+	header   http.Header
+	timer    *time.Timer
+	deadline time.Time
+	wrote    bool
+	timedOut bool
+	done     bool
+}
+
+// Header returns the header map of the handler.
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// WriteHeader sends the headers of the handler unless the request timed out.
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) writeHeader(code int) {
+	if tw.wrote || tw.timedOut {
+		return
+	}
+	tw.wrote = true
+	header := tw.ResponseWriter.Header()
+	for key, values := range tw.header {
+		header[key] = values
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the response of the handler unless the request timed out.
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client and extends the deadline.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeader(http.StatusOK)
+	tw.controller.Flush()
+	tw.deadline = time.Now().Add(tw.options.Timeout)
+	tw.timer.Reset(tw.options.Timeout)
+	tw.extendWrite()
+}
+
+// Hijack takes over the connection, ex. for WebSocket. The timeout no longer
+// applies to a hijacked connection.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	conn, rw, err := tw.controller.Hijack()
+	if err == nil {
+		tw.done = true
+		tw.timer.Stop()
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// reset replaces the options with those of a timeout closer to the route.
+func (tw *timeoutWriter) reset(options TimeoutOptions) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.options = options
+	tw.deadline = tw.start.Add(options.Timeout)
+	tw.timer.Reset(time.Until(tw.deadline))
+	tw.extendWrite()
+}
+
+// expire sends the timeout response if the handler has not written and
+// reports whether the request context should be cancelled. A streaming
+// handler is cancelled when it did not flush within the timeout.
+func (tw *timeoutWriter) expire() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.done || tw.timedOut || time.Now().Before(tw.deadline) {
+		return false
+	}
+	if !tw.wrote {
+		tw.timedOut = true
+		tw.options.OnError(tw.ResponseWriter, tw.request, tw.options.Status)
+		tw.controller.Flush()
+	}
+	return true
+}
+
+// stop is called when the handler returns. A timer that already fired but
+// waits for the lock no longer responds, and the headers of a handler that
+// did not write are passed on for the implicit response.
+func (tw *timeoutWriter) stop() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.done = true
+	tw.timer.Stop()
+	if tw.wrote || tw.timedOut {
+		return
+	}
+	header := tw.ResponseWriter.Header()
+	for key, values := range tw.header {
+		header[key] = values
+	}
+}
+
+// extendWrite moves the write deadline of the connection past the deadline.
+// Writers that do not support deadlines are ignored.
+func (tw *timeoutWriter) extendWrite() {
+	tw.controller.SetWriteDeadline(tw.deadline.Add(timeoutGrace))
+}
@@ -0,0 +1,143 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	var handlerErr, writeErr error
+	router := NewRouter(Timeout(20 * time.Millisecond))
+	router.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		handlerErr = r.Context().Err()
+		_, writeErr = io.WriteString(w, "too late")
+	})
+	router.Get("/fast", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("expected deadline on request context")
+		}
+		io.WriteString(w, "fast")
+	})
+	router.With(Timeout(time.Second)).Get("/override", func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "override")
+	})
+	router.With(RequestTimeout(TimeoutOptions{
+		Timeout: 10 * time.Millisecond,
+		Status:  http.StatusGatewayTimeout,
+		OnError: func(w http.ResponseWriter, _ *http.Request, status int) {
+			w.WriteHeader(status)
+			io.WriteString(w, "custom timeout")
+		},
+	})).Get("/custom", func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	router.Get("/header", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Result", "kept")
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/slow", http.StatusServiceUnavailable, "Service Unavailable\n"},
+		{"/fast", http.StatusOK, "fast"},
+		{"/override", http.StatusOK, "override"},
+		{"/custom", http.StatusGatewayTimeout, "custom timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Error("expected", tt.status, "got", w.Code)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("Expected '%s', got '%s'", tt.body, w.Body.String())
+			}
+		})
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/header", nil))
+	if w.Header().Get("X-Result") != "kept" {
+		t.Error("expected header of handler without body, got", w.Header())
+	}
+	if !errors.Is(handlerErr, context.DeadlineExceeded) {
+		t.Error("expected deadline exceeded, got", handlerErr)
+	}
+	if !errors.Is(writeErr, http.ErrHandlerTimeout) {
+		t.Error("expected handler timeout on write, got", writeErr)
+	}
+}
+
+func TestTimeoutStreaming(t *testing.T) {
+	router := NewRouter(Timeout(30 * time.Millisecond))
+	router.Get("/stream", func(w http.ResponseWriter, r *http.Request) {
+		controller := http.NewResponseController(w)
+		for range 5 {
+			io.WriteString(w, "tick\n")
+			if err := controller.Flush(); err != nil {
+				t.Error("flush", err)
+			}
+			time.Sleep(15 * time.Millisecond)
+		}
+		if r.Context().Err() != nil {
+			t.Error("streaming request cancelled", r.Context().Err())
+		}
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.Count(string(body), "tick") != 5 {
+		t.Error("expected 5 ticks, got", resp.StatusCode, string(body))
+	}
+}
+
+func TestTimeoutHijack(t *testing.T) {
+	router := NewRouter(Timeout(20 * time.Millisecond))
+	router.WebSocket("/ws", echo)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client, resp := dialWebSocket(t, server, "/ws", nil)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("expected", http.StatusSwitchingProtocols, "got", resp.StatusCode)
+	}
+	time.Sleep(60 * time.Millisecond)
+	client.send(0x80|opText, []byte("still open"))
+	if _, payload := client.receive(); string(payload) != "still open" {
+		t.Errorf("Expected 'still open', got '%s'", payload)
+	}
+}
+
+func TestTimeoutGroupRenderer(t *testing.T) {
+	router := NewRouter(Timeout(10 * time.Millisecond))
+	api := router.Group("/api")
+	api.RenderErrors(ErrorRendererFunc(func(w http.ResponseWriter, _ *http.Request, p *Problem) {
+		w.WriteHeader(p.Status)
+		io.WriteString(w, "api: "+p.Title)
+	}))
+	api.Get("/slow", func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/slow", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "api: Service Unavailable" {
+		t.Error("expected group renderer, got", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,255 @@
+package mux
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	traceParentHeader = "traceparent"
+	traceStateHeader  = "tracestate"
+	maxTraceState     = 512
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the hex encoding of the trace id.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the id is not all zeros.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the hex encoding of the span id.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the id is not all zeros.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// Span records the handling of a request.
+type Span struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	TraceState string
+	Sampled    bool
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Status     int
+
+	mu         sync.Mutex
+	attributes map[string]any
+}
+
+// SetAttribute sets an attribute on the span. Values should be strings,
+// bools, integers or floats.
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = map[string]any{}
+	}
+	s.attributes[key] = value
+}
+
+// Attributes returns a copy of the attributes of the span.
+func (s *Span) Attributes() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attributes := make(map[string]any, len(s.attributes))
+	for key, value := range s.attributes {
+		attributes[key] = value
+	}
+	return attributes
+}
+
+// TraceParent returns the traceparent header value for calls made on behalf
+// of the span.
+func (s *Span) TraceParent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return "00-" + s.TraceID.String() + "-" + s.SpanID.String() + "-" + flags
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the span of the request, or nil if the request
+// is not traced.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// InjectTraceContext sets the traceparent and tracestate headers for an
+// outgoing request made while handling a traced request, ex.
+// mux.InjectTraceContext(r.Context(), outgoing.Header) .
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set(traceParentHeader, span.TraceParent())
+	if span.TraceState != "" {
+		header.Set(traceStateHeader, span.TraceState)
+	}
+}
+
+// Exporter receives finished spans. Export is called when the request
+// completes and should not block.
+type Exporter interface {
+	Export(ctx context.Context, span *Span) error
+}
+
+// TracingOptions configures Tracing.
+type TracingOptions struct {
+	// Exporter receives sampled spans.
+	Exporter Exporter
+	// Sample decides whether a new trace, started by a request without a
+	// traceparent header, is sampled. All new traces are sampled when nil.
+	// Requests with a traceparent keep the decision of the caller.
+	Sample func(*http.Request) bool
+}
+
+// Tracing is a middleware that creates a span per request following the W3C
+// Trace Context recommendation. The traceparent and tracestate headers of
+// the request are continued, the span is available to handlers with
+// SpanFromContext and it is exported with the route pattern, status and
+// timing once the request completes.
+func Tracing(options TracingOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := &Span{Start: time.Now()}
+			if traceID, parentID, sampled, ok := parseTraceParent(
+				r.Header.Get(traceParentHeader)); ok {
+				span.TraceID, span.ParentID, span.Sampled = traceID, parentID, sampled
+				span.TraceState = parseTraceState(r.Header.Values(traceStateHeader))
+			} else {
+				rand.Read(span.TraceID[:])
+				span.Sampled = options.Sample == nil || options.Sample(r)
+			}
+			rand.Read(span.SpanID[:])
+			r = trackPattern(r)
+			r = r.WithContext(context.WithValue(r.Context(), spanKey{}, span))
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			span.End = time.Now()
+			span.Status = rec.status
+			route := routeOf(Pattern(r))
+			span.Name = strings.TrimSpace(r.Method + " " + route)
+			span.SetAttribute("http.request.method", r.Method)
+			span.SetAttribute("http.response.status_code", rec.status)
+			span.SetAttribute("url.path", r.URL.Path)
+			span.SetAttribute("server.address", r.Host)
+			if route != "" {
+				span.SetAttribute("http.route", route)
+			}
+			if ua := r.UserAgent(); ua != "" {
+				span.SetAttribute("user_agent.original", ua)
+			}
+			if span.Sampled && options.Exporter != nil {
+				options.Exporter.Export(r.Context(), span)
+			}
+		})
+	}
+}
+
+// parseTraceParent parses a traceparent header, version-format
+// 00-<trace-id>-<parent-id>-<trace-flags>. Higher versions are parsed as
+// version 00 as required by the recommendation.
+func parseTraceParent(header string) (TraceID, SpanID, bool, bool) {
+	var traceID TraceID
+	var parentID SpanID
+	header = strings.TrimSpace(header)
+	if len(header) < 55 || (len(header) > 55 && header[55] != '-') {
+		return traceID, parentID, false, false
+	}
+	version, err := hex.DecodeString(header[0:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(header) != 55) ||
+		header[2] != '-' || header[35] != '-' || header[52] != '-' {
+		return traceID, parentID, false, false
+	}
+	if !isLowerHex(header[3:35]) || !isLowerHex(header[36:52]) {
+		return traceID, parentID, false, false
+	}
+	flags, err := hex.DecodeString(header[53:55])
+	if err != nil {
+		return traceID, parentID, false, false
+	}
+	hex.Decode(traceID[:], []byte(header[3:35]))
+	hex.Decode(parentID[:], []byte(header[36:52]))
+	if !traceID.IsValid() || !parentID.IsValid() {
+		return traceID, parentID, false, false
+	}
+	return traceID, parentID, flags[0]&1 == 1, true
+}
+
+func isLowerHex(s string) bool {
+	return !strings.ContainsFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && (r < 'a' || r > 'f')
+	})
+}
+
+// parseTraceState joins tracestate headers, dropping the value when it
+// exceeds the maximum length.
+func parseTraceState(values []string) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	state := strings.Join(parts, ",")
+	if len(state) > maxTraceState {
+		return ""
+	}
+	return state
+}
+
+// InMemoryExporter keeps exported spans in memory, for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// Export stores the span.
+func (e *InMemoryExporter) Export(_ context.Context, span *Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans returns the exported spans.
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.spans)
+}
+
+// Reset removes all exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,145 @@
+package mux
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	router := NewRouter(Tracing(TracingOptions{Exporter: exporter}))
+	api := router.Group("/api")
+	var outgoing http.Header
+	api.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		span := SpanFromContext(r.Context())
+		if span == nil {
+			t.Fatal("expected span in context")
+		}
+		span.SetAttribute("item.id", r.PathValue("id"))
+		outgoing = http.Header{}
+		InjectTraceContext(r.Context(), outgoing)
+		io.WriteString(w, "item")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/items/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatal("expected 1 span, got", len(spans))
+	}
+	span := spans[0]
+	if span.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		span.ParentID.String() != "00f067aa0ba902b7" || !span.Sampled {
+		t.Error("trace context not continued", span.TraceID, span.ParentID)
+	}
+	if span.Name != "GET /api/items/{id}" || span.Status != http.StatusOK {
+		t.Error("wrong span", span.Name, span.Status)
+	}
+	attributes := span.Attributes()
+	if attributes["http.route"] != "/api/items/{id}" || attributes["item.id"] != "7" {
+		t.Error("wrong attributes", attributes)
+	}
+	if outgoing.Get("traceparent") != span.TraceParent() ||
+		outgoing.Get("tracestate") != "congo=t61rcWkgMzE" {
+		t.Error("trace context not injected", outgoing)
+	}
+
+	t.Run("newTrace", func(t *testing.T) {
+		exporter.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+		req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		spans := exporter.Spans()
+		if len(spans) != 1 || spans[0].ParentID.IsValid() || !spans[0].TraceID.IsValid() {
+			t.Fatal("expected new trace", spans)
+		}
+		if spans[0].Name != "GET" || spans[0].Status != http.StatusNotFound {
+			t.Error("wrong span", spans[0].Name, spans[0].Status)
+		}
+	})
+
+	t.Run("notSampled", func(t *testing.T) {
+		exporter.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/api/items/1", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if len(exporter.Spans()) != 0 {
+			t.Error("expected unsampled span not to be exported")
+		}
+	})
+}
+
+func TestTracingGroup(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	router := NewRouter()
+	api := router.Group("/api", Tracing(TracingOptions{Exporter: exporter}))
+	api.Get("/items/{id}", func(http.ResponseWriter, *http.Request) {})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/items/7", nil))
+
+	spans := exporter.Spans()
+	if len(spans) != 1 || spans[0].Name != "GET /api/items/{id}" {
+		t.Fatal("expected span GET /api/items/{id}, got", spans)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":         true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future":  true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-invalid": false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":         false,
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":         false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":         false,
+		"garbage": false,
+	}
+	for header, valid := range tests {
+		if _, _, _, ok := parseTraceParent(header); ok != valid {
+			t.Errorf("%s: expected valid %v", header, valid)
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan map[string]any, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		received <- payload
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(OTLPOptions{
+		Endpoint:    collector.URL + "/v1/traces",
+		ServiceName: "test",
+		Interval:    time.Hour,
+	})
+	router := NewRouter(Tracing(TracingOptions{Exporter: exporter}))
+	router.Get("/", dummyHandler)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	payload := <-received
+	resourceSpans := payload["resourceSpans"].([]any)[0].(map[string]any)
+	scopeSpans := resourceSpans["scopeSpans"].([]any)[0].(map[string]any)
+	span := scopeSpans["spans"].([]any)[0].(map[string]any)
+	if span["name"] != "GET /" || span["kind"] != float64(2) || len(span["traceId"].(string)) != 32 {
+		t.Error("wrong span", span)
+	}
+	if err := exporter.Export(ctx, &Span{}); err == nil {
+		t.Error("expected export after shutdown to fail")
+	}
+}
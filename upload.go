@@ -0,0 +1,542 @@
+package mux
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultMaxUpload = 32 << 20
+	defaultExpires   = 24 * time.Hour
+	// multipartOverhead is added to MaxSize for the default MaxRequestSize.
+	multipartOverhead = 1 << 20
+	tusVersion        = "1.0.0"
+	tusContentType    = "application/offset+octet-stream"
+	partialPrefix     = ".upload-"
+	partialSuffix     = ".part"
+	sniffLen          = 512
+	maxFilenameLen    = 255
+)
+
+var (
+	errUploadTooLarge = errors.New("upload too large")
+	errUploadType     = errors.New("upload type not allowed")
+)
+
+// UploadStore is a writable store for uploaded files. Names are plain file
+// names without directories.
+type UploadStore interface {
+	// Create creates or truncates the named file.
+	Create(name string) (io.WriteCloser, error)
+	// Append opens the named file for appending.
+	Append(name string) (io.WriteCloser, error)
+	// Size returns the size of the named file.
+	Size(name string) (int64, error)
+	// Rename atomically replaces newname with oldname.
+	Rename(oldname, newname string) error
+	// Remove removes the named file.
+	Remove(name string) error
+}
+
+// DirStore returns an UploadStore that writes files to dir.
+func DirStore(dir string) UploadStore {
+	return dirStore(dir)
+}
+
+type dirStore string
+
+func (d dirStore) path(name string) string {
+	return filepath.Join(string(d), filepath.Base(name))
+}
+
+func (d dirStore) Create(name string) (io.WriteCloser, error) {
+	return os.OpenFile(d.path(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+}
+
+func (d dirStore) Append(name string) (io.WriteCloser, error) {
+	return os.OpenFile(d.path(name), os.O_WRONLY|os.O_APPEND, 0o600)
+}
+
+func (d dirStore) Size(name string) (int64, error) {
+	info, err := os.Stat(d.path(name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (d dirStore) Rename(oldname, newname string) error {
+	return os.Rename(d.path(oldname), d.path(newname))
+}
+
+func (d dirStore) Remove(name string) error {
+	return os.Remove(d.path(name))
+}
+
+// UploadOptions configures the handlers registered by Upload.
+type UploadOptions struct {
+	// Dir is the directory uploads are written to when Store is nil.
+	Dir string
+	// Store receives the uploaded files.
+	Store UploadStore
+	// MaxSize is the maximum size of a single file. Defaults to 32 MiB.
+	MaxSize int64
+	// MaxRequestSize is the maximum size of a multipart request including
+	// all of its files. Defaults to MaxSize plus 1 MiB for the form.
+	MaxRequestSize int64
+	// AllowedTypes restricts uploads to the listed media types, ex.
+	// image/png or image/*. The type is detected from the file content.
+	// All types are allowed when empty.
+	AllowedTypes []string
+	// Overwrite replaces existing files with the same name. By default a
+	// numeric suffix is added to the name of the new file.
+	Overwrite bool
+	// Resumable enables chunked uploads using the tus 1.0 protocol with the
+	// creation, expiration and termination extensions. Pending uploads are
+	// tracked in memory and do not survive a restart. Chunks must be sent
+	// with a Content-Length.
+	Resumable bool
+	// Expires is the time a client has to complete a resumable upload.
+	// Incomplete uploads are removed afterwards. Defaults to 24 hours.
+	Expires time.Duration
+}
+
+// UploadedFile describes a stored upload.
+type UploadedFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Type string `json:"type"`
+}
+
+// Upload registers handlers that store uploaded files.
+// POST requests to pattern accept multipart/form-data and respond with the
+// stored files as JSON. With Resumable set, pattern also implements the tus
+// protocol; clients create an upload with POST and send chunks with PATCH to
+// the returned Location, which is relative to pattern so that it also
+// works inside a Group.
+func (router *Router) Upload(pattern string, options UploadOptions) {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if options.Store == nil {
+		options.Store = DirStore(options.Dir)
+	}
+	if options.MaxSize <= 0 {
+		options.MaxSize = defaultMaxUpload
+	}
+	if options.MaxRequestSize <= 0 {
+		options.MaxRequestSize = options.MaxSize + multipartOverhead
+	}
+	if options.Expires <= 0 {
+		options.Expires = defaultExpires
+	}
+	u := &uploader{options: options, router: router, pending: map[string]*pendingUpload{}}
+	router.Post(pattern, u.post)
+	if !options.Resumable {
+		return
+	}
+	router.CustomMethod(http.MethodOptions, pattern, u.capabilities)
+	router.CustomMethod(http.MethodHead, pattern+"/{id}", u.head)
+	router.Patch(pattern+"/{id}", u.patch)
+	router.Delete(pattern+"/{id}", u.delete)
+}
+
+// SanitizeFilename returns a safe file name for a client supplied name.
+// Directories are removed, characters other than letters, digits, dot,
+// dash and underscore are replaced and leading dots are stripped.
+func SanitizeFilename(name string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	name = strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) ||
+			r == '.' || r == '-' || r == '_') {
+			return r
+		}
+		return '_'
+	}, name)
+	name = strings.TrimLeft(name, ".")
+	if len(name) > maxFilenameLen {
+		ext := filepath.Ext(name)
+		if len(ext) > maxFilenameLen/2 {
+			ext = ""
+		}
+		name = name[:maxFilenameLen-len(ext)] + ext
+	}
+	if name == "" {
+		name = "upload"
+	}
+	return name
+}
+
+type uploader struct {
+	options UploadOptions
+	router  *Router
+
+	mu      sync.Mutex
+	pending map[string]*pendingUpload
+}
+
+type pendingUpload struct {
+	mu      sync.Mutex
+	name    string
+	length  int64
+	expires time.Time
+	timer   *time.Timer
+}
+
+func (u *uploader) post(w http.ResponseWriter, r *http.Request) {
+	if u.options.Resumable && r.Header.Get("Tus-Resumable") != "" {
+		u.create(w, r)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, u.options.MaxRequestSize)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files := []UploadedFile{}
+	// files of a failed request are removed, so that a request is stored
+	// completely or not at all
+	remove := func() {
+		for _, file := range files {
+			u.options.Store.Remove(file.Name)
+		}
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			remove()
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				uploadError(w, err)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		file, err := u.store(part, SanitizeFilename(part.FileName()))
+		part.Close()
+		if err != nil {
+			remove()
+			uploadError(w, err)
+			return
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		http.Error(w, "no files uploaded", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(files)
+}
+
+// store writes src to a temporary file and renames it to name when complete.
+func (u *uploader) store(src io.Reader, name string) (UploadedFile, error) {
+	file := UploadedFile{}
+	reader := bufio.NewReaderSize(src, sniffLen)
+	head, _ := reader.Peek(sniffLen)
+	contentType, err := u.checkType(head)
+	if err != nil {
+		return file, err
+	}
+	partial := partialPrefix + rand.Text() + partialSuffix
+	dst, err := u.options.Store.Create(partial)
+	if err != nil {
+		return file, err
+	}
+	size, err := io.Copy(dst, io.LimitReader(reader, u.options.MaxSize+1))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > u.options.MaxSize {
+		err = errUploadTooLarge
+	}
+	if err == nil {
+		name, err = u.finish(partial, name)
+	}
+	if err != nil {
+		u.options.Store.Remove(partial)
+		return file, err
+	}
+	return UploadedFile{Name: name, Size: size, Type: contentType}, nil
+}
+
+// finish renames a completed partial upload to its final name.
+func (u *uploader) finish(partial, name string) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.options.Overwrite {
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for i := 1; u.exists(name); i++ {
+			name = base + "-" + strconv.Itoa(i) + ext
+		}
+	}
+	return name, u.options.Store.Rename(partial, name)
+}
+
+func (u *uploader) exists(name string) bool {
+	_, err := u.options.Store.Size(name)
+	return err == nil
+}
+
+// checkType detects the media type of head and checks it against the
+// allowed types.
+func (u *uploader) checkType(head []byte) (string, error) {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if len(u.options.AllowedTypes) == 0 {
+		return contentType, nil
+	}
+	for _, allowed := range u.options.AllowedTypes {
+		prefix, ok := strings.CutSuffix(allowed, "*")
+		if allowed == contentType || ok && strings.HasPrefix(contentType, prefix) {
+			return contentType, nil
+		}
+	}
+	return contentType, errUploadType
+}
+
+func (u *uploader) capabilities(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,expiration,termination")
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(u.options.MaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// create starts a resumable upload.
+func (u *uploader) create(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if length > u.options.MaxSize {
+		uploadError(w, errUploadTooLarge)
+		return
+	}
+	name := SanitizeFilename(tusMetadata(r.Header.Get("Upload-Metadata"))["filename"])
+	id := strings.ToLower(rand.Text())
+	dst, err := u.options.Store.Create(partialPrefix + id + partialSuffix)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	dst.Close()
+	upload := &pendingUpload{
+		name:    name,
+		length:  length,
+		expires: time.Now().Add(u.options.Expires),
+	}
+	u.mu.Lock()
+	u.pending[id] = upload
+	upload.timer = time.AfterFunc(u.options.Expires, func() { u.expire(id, upload) })
+	u.mu.Unlock()
+	w.Header().Set("Location", path.Base(r.URL.Path)+"/"+id)
+	w.Header().Set("Upload-Expires", upload.expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// expire removes an upload that was not completed in time. A chunk that is
+// being received is finished first.
+func (u *uploader) expire(id string, upload *pendingUpload) {
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	if u.remove(id, upload) {
+		u.options.Store.Remove(partialPrefix + id + partialSuffix)
+	}
+}
+
+// remove stops tracking upload and reports whether it was still pending.
+// The lock of the upload must be held.
+func (u *uploader) remove(id string, upload *pendingUpload) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.pending[id] != upload {
+		return false
+	}
+	delete(u.pending, id)
+	upload.timer.Stop()
+	return true
+}
+
+// lock acquires the lock of a pending upload and reports whether it is
+// still pending. Requests for an upload that is being written fail.
+func (u *uploader) lock(w http.ResponseWriter, r *http.Request, upload *pendingUpload) bool {
+	if !upload.mu.TryLock() {
+		http.Error(w, "upload in progress", http.StatusLocked)
+		return false
+	}
+	u.mu.Lock()
+	pending := u.pending[r.PathValue("id")] == upload
+	u.mu.Unlock()
+	if !pending {
+		upload.mu.Unlock()
+		u.router.notFoundHandler()(w, r)
+	}
+	return pending
+}
+
+func (u *uploader) lookup(w http.ResponseWriter, r *http.Request) *pendingUpload {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	u.mu.Lock()
+	upload := u.pending[r.PathValue("id")]
+	u.mu.Unlock()
+	if upload == nil {
+		u.router.notFoundHandler()(w, r)
+	}
+	return upload
+}
+
+func (u *uploader) head(w http.ResponseWriter, r *http.Request) {
+	upload := u.lookup(w, r)
+	if upload == nil {
+		return
+	}
+	offset, err := u.options.Store.Size(partialPrefix + r.PathValue("id") + partialSuffix)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.length, 10))
+	w.Header().Set("Upload-Expires", upload.expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// patch appends a chunk to a resumable upload and stores the file once all
+// bytes have been received.
+func (u *uploader) patch(w http.ResponseWriter, r *http.Request) {
+	upload := u.lookup(w, r)
+	if upload == nil {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusContentType {
+		http.Error(w, "Content-Type must be "+tusContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	if !u.lock(w, r, upload) {
+		return
+	}
+	defer upload.mu.Unlock()
+	id := r.PathValue("id")
+	partial := partialPrefix + id + partialSuffix
+	offset, err := u.options.Store.Size(partial)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	if r.Header.Get("Upload-Offset") != strconv.FormatInt(offset, 10) {
+		http.Error(w, "Upload-Offset mismatch", http.StatusConflict)
+		return
+	}
+	// the length is checked before anything is written, so a chunk is
+	// either rejected or appended completely
+	if r.ContentLength < 0 {
+		http.Error(w, "Content-Length required", http.StatusLengthRequired)
+		return
+	}
+	if r.ContentLength > upload.length-offset {
+		uploadError(w, errUploadTooLarge)
+		return
+	}
+	reader := bufio.NewReaderSize(io.LimitReader(r.Body, r.ContentLength), sniffLen)
+	if offset == 0 {
+		head, _ := reader.Peek(sniffLen)
+		if _, err := u.checkType(head); err != nil {
+			uploadError(w, err)
+			return
+		}
+	}
+	dst, err := u.options.Store.Append(partial)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	written, err := io.Copy(dst, reader)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	offset += written
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Expires", upload.expires.UTC().Format(http.TimeFormat))
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	if offset == upload.length {
+		u.remove(id, upload)
+		if _, err := u.finish(partial, upload.name); err != nil {
+			u.options.Store.Remove(partial)
+			uploadError(w, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *uploader) delete(w http.ResponseWriter, r *http.Request) {
+	upload := u.lookup(w, r)
+	if upload == nil {
+		return
+	}
+	if !u.lock(w, r, upload) {
+		return
+	}
+	defer upload.mu.Unlock()
+	id := r.PathValue("id")
+	u.remove(id, upload)
+	u.options.Store.Remove(partialPrefix + id + partialSuffix)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func uploadError(w http.ResponseWriter, err error) {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.Is(err, errUploadTooLarge), errors.As(err, &maxBytes):
+		http.Error(w, errUploadTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errUploadType):
+		http.Error(w, errUploadType.Error(), http.StatusUnsupportedMediaType)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+	}
+}
+
+// tusMetadata decodes the Upload-Metadata header, a comma separated list of
+// keys with base64 encoded values.
+func tusMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+	for pair := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if key == "" || err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
@@ -0,0 +1,240 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func multipartRequest(t *testing.T, target, filename string, content []byte) *http.Request {
+	t.Helper()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, target, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestUploadMultipart(t *testing.T) {
+	dir := t.TempDir()
+	router := NewRouter()
+	router.Upload("/upload", UploadOptions{Dir: dir, MaxSize: 64, AllowedTypes: []string{"text/*"}})
+
+	t.Run("stored", func(t *testing.T) {
+		for _, want := range []string{"notes.txt", "notes-1.txt"} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, multipartRequest(t, "/upload", "../../notes.txt", []byte("hello")))
+			if w.Code != http.StatusCreated {
+				t.Fatal("expected", http.StatusCreated, "got", w.Code, w.Body.String())
+			}
+			var files []UploadedFile
+			if err := json.NewDecoder(w.Body).Decode(&files); err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 || files[0].Name != want || files[0].Type != "text/plain" {
+				t.Error("wrong upload", files)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, want))
+			if err != nil || string(data) != "hello" {
+				t.Error("file not stored", err, string(data))
+			}
+		}
+	})
+
+	t.Run("tooLarge", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, multipartRequest(t, "/upload", "big.txt", bytes.Repeat([]byte("a"), 65)))
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Error("expected", http.StatusRequestEntityTooLarge, "got", w.Code)
+		}
+	})
+
+	t.Run("type", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, multipartRequest(t, "/upload", "x.png", []byte("\x89PNG\r\n\x1a\n")))
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Error("expected", http.StatusUnsupportedMediaType, "got", w.Code)
+		}
+	})
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Error("expected 2 stored files, got", len(entries))
+	}
+}
+
+func TestUploadMultipartFailure(t *testing.T) {
+	dir := t.TempDir()
+	router := NewRouter()
+	router.Upload("/upload", UploadOptions{
+		Dir: dir, MaxSize: 64, MaxRequestSize: 512, AllowedTypes: []string{"text/*"},
+	})
+	request := func(files ...[]byte) *http.Request {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		for i, content := range files {
+			part, _ := writer.CreateFormFile("file", "file"+strconv.Itoa(i)+".txt")
+			part.Write(content)
+		}
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req
+	}
+	text := bytes.Repeat([]byte("a"), 60)
+
+	tests := []struct {
+		name   string
+		files  [][]byte
+		status int
+	}{
+		{"requestLimit", slices.Repeat([][]byte{text}, 10), http.StatusRequestEntityTooLarge},
+		{"laterPart", [][]byte{text, []byte("\x89PNG\r\n\x1a\n")},
+			http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request(tt.files...))
+		if w.Code != tt.status {
+			t.Error(tt.name, "expected", tt.status, "got", w.Code)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Error(tt.name, "expected stored files removed, got", len(entries))
+		}
+	}
+}
+
+func TestUploadResumable(t *testing.T) {
+	dir := t.TempDir()
+	router := NewRouter()
+	router.Group("/api").Upload("/files", UploadOptions{Dir: dir, Resumable: true})
+	content := []byte("hello resumable world")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/files", nil)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Length", strconv.Itoa(len(content)))
+	req.Header.Set("Upload-Metadata", "filename cmVwb3J0LnR4dA==")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatal("expected", http.StatusCreated, "got", w.Code, w.Body.String())
+	}
+	if _, err := http.ParseTime(w.Header().Get("Upload-Expires")); err != nil {
+		t.Error("expected Upload-Expires, got", w.Header().Get("Upload-Expires"))
+	}
+	base, _ := url.Parse("/api/files")
+	ref, _ := url.Parse(w.Header().Get("Location"))
+	location := base.ResolveReference(ref).String()
+	if !strings.HasPrefix(location, "/api/files/") {
+		t.Fatal("expected location inside group, got", location)
+	}
+
+	patch := func(offset int, chunk []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, location, bytes.NewReader(chunk))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	if w := patch(0, content[:5]); w.Code != http.StatusNoContent ||
+		w.Header().Get("Upload-Offset") != "5" {
+		t.Fatal("first chunk", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if w := patch(0, content[5:]); w.Code != http.StatusConflict {
+		t.Error("expected", http.StatusConflict, "got", w.Code)
+	}
+	if w := patch(5, append(content[5:len(content):len(content)], '!')); w.Code !=
+		http.StatusRequestEntityTooLarge {
+		t.Error("expected", http.StatusRequestEntityTooLarge, "got", w.Code)
+	}
+	req = httptest.NewRequest(http.MethodPatch, location, io.MultiReader(bytes.NewReader(content)))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", "5")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusLengthRequired {
+		t.Error("expected", http.StatusLengthRequired, "got", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodHead, location, nil)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Upload-Offset") != "5" {
+		t.Error("wrong offset", w.Header().Get("Upload-Offset"))
+	}
+
+	if w := patch(5, content[5:]); w.Code != http.StatusNoContent {
+		t.Fatal("last chunk", w.Code, w.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "report.txt"))
+	if err != nil || !bytes.Equal(data, content) {
+		t.Error("file not stored", err, string(data))
+	}
+	if w := patch(len(content), nil); w.Code != http.StatusNotFound {
+		t.Error("expected completed upload to be gone, got", w.Code)
+	}
+}
+
+func TestUploadExpires(t *testing.T) {
+	dir := t.TempDir()
+	router := NewRouter()
+	router.Upload("/files", UploadOptions{Dir: dir, Resumable: true, Expires: time.Millisecond})
+	req := httptest.NewRequest(http.MethodPost, "/files", nil)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Length", "10")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatal("expected", http.StatusCreated, "got", w.Code)
+	}
+	location := "/" + w.Header().Get("Location")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodHead, location, nil))
+		entries, _ := os.ReadDir(dir)
+		if w.Code == http.StatusNotFound && len(entries) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected expired upload removed, got", w.Code, entries)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := map[string]string{
+		"../../etc/passwd": "passwd",
+		`C:\temp\a b.txt`:  "a_b.txt",
+		".env":             "env",
+		"":                 "upload",
+		"héllo.txt":        "h_llo.txt",
+	}
+	for name, want := range tests {
+		if got := SanitizeFilename(name); got != want {
+			t.Errorf("%q: expected '%s', got '%s'", name, want, got)
+		}
+	}
+}
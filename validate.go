@@ -0,0 +1,180 @@
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validator is implemented by request types with validation rules that
+// cannot be expressed with validate tags. Errors other than a
+// ValidationError are reported without a field.
+type Validator interface {
+	Validate() error
+}
+
+// Validate checks the validate tags of the fields of the struct v and calls
+// its Validate method if it implements Validator. It returns a
+// ValidationError with status 422 listing all invalid fields. Supported
+// rules, separated by commas, ex. `validate:"required,max=64"`:
+//
+//	required   the field must not be the zero value
+//	min=n      minimum value of numbers or length of strings, slices and maps
+//	max=n      maximum value of numbers or length of strings, slices and maps
+//	oneof=a b  the field must be one of the space separated values
+//	email      the field must be an email address
+//
+// Rules other than required are skipped for fields with the zero value.
+// Nested structs and slices of structs are validated recursively.
+func Validate(v any) error {
+	errs := validateValue(reflect.ValueOf(v), "")
+	if validator, ok := v.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				errs = append(errs, validationErr.Errors...)
+			} else {
+				errs = append(errs, FieldError{Message: err.Error()})
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Status: http.StatusUnprocessableEntity, Errors: errs}
+}
+
+func validateValue(v reflect.Value, prefix string) []FieldError {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	var errs []FieldError
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := prefix + fieldName(field)
+			if field.Anonymous {
+				name = strings.TrimSuffix(prefix, ".")
+			}
+			if rules, ok := field.Tag.Lookup("validate"); ok {
+				if message := checkRules(v.Field(i), rules); message != "" {
+					errs = append(errs, FieldError{Field: name, Message: message})
+					continue
+				}
+			}
+			if name != "" {
+				name += "."
+			}
+			errs = append(errs, validateValue(v.Field(i), name)...)
+		}
+	case reflect.Slice, reflect.Array:
+		if indirectType(v.Type().Elem()).Kind() != reflect.Struct {
+			return nil
+		}
+		base := strings.TrimSuffix(prefix, ".")
+		for i := range v.Len() {
+			errs = append(errs, validateValue(v.Index(i), base+"["+strconv.Itoa(i)+"].")...)
+		}
+	}
+	return errs
+}
+
+// fieldName returns the name of a field in requests: its json, query or
+// path name, or the Go name.
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "query", "path", "form", "header", "cookie"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// checkRules returns a message describing the first failed rule.
+func checkRules(v reflect.Value, rules string) string {
+	zero := v.IsZero()
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	for rule := range strings.SplitSeq(rules, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "required" {
+			if zero {
+				return "is required"
+			}
+			continue
+		}
+		if zero {
+			continue
+		}
+		if message := checkRule(v, name, arg); message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+func checkRule(v reflect.Value, name, arg string) string {
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return "has an invalid " + name + " rule"
+		}
+		value, unit := measure(v)
+		switch {
+		case name == "min" && value < limit && unit != "":
+			return "must have at least " + arg + " " + unit
+		case name == "min" && value < limit:
+			return "must be at least " + arg
+		case name == "max" && value > limit && unit != "":
+			return "must have at most " + arg + " " + unit
+		case name == "max" && value > limit:
+			return "must be at most " + arg
+		}
+	case "oneof":
+		if !slices.Contains(strings.Fields(arg), fmt.Sprint(v.Interface())) {
+			return "must be one of " + strings.Join(strings.Fields(arg), ", ")
+		}
+	case "email":
+		address, err := mail.ParseAddress(v.String())
+		if v.Kind() != reflect.String || err != nil || address.Address != v.String() {
+			return "must be an email address"
+		}
+	default:
+		return "has an unknown rule " + name
+	}
+	return ""
+}
+
+// measure returns the value of numbers, or the length of strings, slices
+// and maps with its unit.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "elements"
+	default:
+		return 0, ""
+	}
+}
@@ -0,0 +1,655 @@
+package mux
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	websocketGUID           = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	defaultWebSocketMessage = 1 << 20
+	websocketCloseTimeout   = time.Second
+	deflateExtension        = "permessage-deflate; server_no_context_takeover; " +
+		"client_no_context_takeover"
+)
+
+// MessageType is the type of a WebSocket message.
+type MessageType int
+
+// WebSocket message types.
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// WebSocket close codes, see RFC 6455 section 7.4.
+const (
+	CloseNormal             = 1000
+	CloseGoingAway          = 1001
+	CloseProtocolError      = 1002
+	CloseUnsupportedData    = 1003
+	CloseNoStatus           = 1005
+	CloseInvalidPayload     = 1007
+	ClosePolicyViolation    = 1008
+	CloseMessageTooBig      = 1009
+	CloseMandatoryExtension = 1010
+	CloseInternalError      = 1011
+)
+
+// ErrCloseSent is returned when writing to a WebSocket after its close frame
+// was sent.
+var ErrCloseSent = errors.New("mux: websocket close sent")
+
+// CloseError is returned by WebSocket.ReadMessage when the connection is
+// closed by the client or because the client violated the protocol. A
+// handler may return a CloseError to close the connection with its code.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+// Error describes the close code and reason.
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return "mux: websocket closed with " + strconv.Itoa(e.Code)
+	}
+	return "mux: websocket closed with " + strconv.Itoa(e.Code) + ": " + e.Reason
+}
+
+// WebSocketOptions configures the handler registered by WebSocketWithOptions.
+type WebSocketOptions struct {
+	// Origins lists the hosts, ex. "app.example.com" or "*.example.com",
+	// allowed in the Origin header of browser requests. "*" allows every
+	// origin. Defaults to the host of the request.
+	Origins []string
+	// Subprotocols lists the supported subprotocols in order of preference.
+	Subprotocols []string
+	// Compression enables the permessage-deflate extension for clients
+	// offering it.
+	Compression bool
+	// MaxMessageSize limits the size of received messages; larger messages
+	// close the connection with CloseMessageTooBig. Defaults to 1MiB.
+	MaxMessageSize int64
+	// PingInterval sends pings at this interval and closes connections that
+	// receive nothing for two intervals while reading. Disabled by default.
+	PingInterval time.Duration
+}
+
+// WebSocket is a server side WebSocket connection (RFC 6455). Messages are
+// read by one goroutine at a time; writes are safe for concurrent use.
+type WebSocket struct {
+	r            *http.Request
+	conn         net.Conn
+	reader       *bufio.Reader
+	subprotocol  string
+	compression  bool
+	maxSize      int64
+	pingInterval time.Duration
+	cancel       context.CancelFunc
+
+	readErr       error
+	closeReceived bool
+
+	writeMu   sync.Mutex
+	writer    *bufio.Writer
+	deflater  *flate.Writer
+	closeSent bool
+}
+
+// WebSocket registers a GET handler for WebSocket connections. The handler
+// runs for the lifetime of the connection; ctx is canceled when the
+// connection closes, ex.
+//
+//	router.WebSocket("/echo", func(ctx context.Context, ws *mux.WebSocket) error {
+//		for {
+//			typ, message, err := ws.ReadMessage()
+//			if err != nil {
+//				return err
+//			}
+//			if err := ws.WriteMessage(typ, message); err != nil {
+//				return err
+//			}
+//		}
+//	})
+//
+// When the handler returns the connection is closed with CloseNormal, the
+// code of a returned CloseError, or CloseInternalError for other errors.
+// Failed handshakes are answered with Error. The connection is hijacked with
+// http.ResponseController, so it works behind middleware wrapping the
+// http.ResponseWriter, such as Logger.
+func (router *Router) WebSocket(pattern string,
+	handler func(ctx context.Context, ws *WebSocket) error,
+) {
+	router.WebSocketWithOptions(pattern, WebSocketOptions{}, handler)
+}
+
+// WebSocketWithOptions registers a handler for WebSocket connections like
+// WebSocket.
+func (router *Router) WebSocketWithOptions(pattern string, options WebSocketOptions,
+	handler func(ctx context.Context, ws *WebSocket) error,
+) {
+	if options.MaxMessageSize <= 0 {
+		options.MaxMessageSize = defaultWebSocketMessage
+	}
+	router.Get(pattern, func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrade(w, r, options)
+		if err != nil {
+			Error(w, r, err)
+			return
+		}
+		if ws == nil {
+			return
+		}
+		ctx, cancel := context.WithCancel(r.Context())
+		ws.cancel = cancel
+		pinging := make(chan struct{})
+		if options.PingInterval > 0 {
+			go ws.ping(ctx, pinging)
+		} else {
+			close(pinging)
+		}
+		err = handler(ctx, ws)
+		cancel()
+		<-pinging
+		ws.finish(err)
+	})
+}
+
+// upgrade performs the opening handshake and hijacks the connection.
+func upgrade(w http.ResponseWriter, r *http.Request, options WebSocketOptions,
+) (*WebSocket, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, &HTTPError{Status: http.StatusBadRequest, Message: "websocket upgrade required"}
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, &HTTPError{Status: http.StatusUpgradeRequired}
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, &HTTPError{Status: http.StatusBadRequest, Message: "invalid Sec-WebSocket-Key"}
+	}
+	if !allowOrigin(r, options.Origins) {
+		return nil, &HTTPError{Status: http.StatusForbidden, Message: "origin not allowed"}
+	}
+	ws := &WebSocket{
+		r:            r,
+		maxSize:      options.MaxMessageSize,
+		pingInterval: options.PingInterval,
+		subprotocol:  selectSubprotocol(r.Header, options.Subprotocols),
+		compression:  options.Compression && offersDeflate(r.Header),
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("mux: websocket hijack: %w", err)
+	}
+	// the deadlines of the server do not apply to the upgraded connection
+	conn.SetDeadline(time.Time{})
+	ws.conn, ws.reader, ws.writer = conn, rw.Reader, rw.Writer
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n" +
+		"Connection: Upgrade\r\nSec-WebSocket-Accept: " +
+		base64.StdEncoding.EncodeToString(sum[:]) + "\r\n"
+	if ws.subprotocol != "" {
+		response += "Sec-WebSocket-Protocol: " + ws.subprotocol + "\r\n"
+	}
+	if ws.compression {
+		response += "Sec-WebSocket-Extensions: " + deflateExtension + "\r\n"
+	}
+	ws.writer.WriteString(response + "\r\n")
+	if err := ws.writer.Flush(); err != nil {
+		// the connection is hijacked, so there is no response to write
+		conn.Close()
+		slog.Error("mux.WebSocket: handshake failed", "path", r.URL.Path, "error", err)
+		return nil, nil
+	}
+	return ws, nil
+}
+
+// headerContains reports whether the comma separated values of the header
+// contain token, ignoring case.
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for part := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowOrigin checks the Origin header sent by browsers against origins, or
+// the host of the request if origins is empty.
+func allowOrigin(r *http.Request, origins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	if len(origins) == 0 {
+		return host == strings.ToLower(r.Host)
+	}
+	for _, pattern := range origins {
+		if matched, _ := path.Match(strings.ToLower(pattern), host); matched || pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func selectSubprotocol(header http.Header, supported []string) string {
+	for _, protocol := range supported {
+		if headerContains(header, "Sec-WebSocket-Protocol", protocol) {
+			return protocol
+		}
+	}
+	return ""
+}
+
+// offersDeflate reports whether the client offers permessage-deflate with
+// parameters compatible with compress/flate, see RFC 7692.
+func offersDeflate(header http.Header) bool {
+	for _, value := range header.Values("Sec-WebSocket-Extensions") {
+		for offer := range strings.SplitSeq(value, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) == "permessage-deflate" &&
+				deflateParamsSupported(params[1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func deflateParamsSupported(params []string) bool {
+	seen := map[string]bool{}
+	for _, param := range params {
+		name, value, _ := strings.Cut(param, "=")
+		name = strings.TrimSpace(name)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if seen[name] {
+			return false
+		}
+		seen[name] = true
+		switch name {
+		case "server_no_context_takeover", "client_no_context_takeover":
+			if value != "" {
+				return false
+			}
+		case "server_max_window_bits":
+			// compress/flate always uses a 32KiB window
+			if value != "15" {
+				return false
+			}
+		case "client_max_window_bits":
+			if value != "" {
+				if bits, err := strconv.Atoi(value); err != nil || bits < 8 || bits > 15 {
+					return false
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Request returns the request that opened the connection.
+func (ws *WebSocket) Request() *http.Request {
+	return ws.r
+}
+
+// Subprotocol returns the negotiated subprotocol, or an empty string.
+func (ws *WebSocket) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// ReadMessage reads the next text or binary message, answering pings and
+// reassembling fragmented messages. After the client closed the connection
+// or violated the protocol it returns a *CloseError.
+func (ws *WebSocket) ReadMessage() (MessageType, []byte, error) {
+	if ws.readErr != nil {
+		return 0, nil, ws.readErr
+	}
+	typ, message, err := ws.readMessage()
+	if err != nil {
+		ws.readErr = err
+		var closeErr *CloseError
+		if errors.As(err, &closeErr) {
+			ws.Close(closeErr.Code, closeErr.Reason)
+		}
+		if ws.cancel != nil {
+			ws.cancel()
+		}
+	}
+	return typ, message, err
+}
+
+func (ws *WebSocket) readMessage() (MessageType, []byte, error) {
+	var (
+		message    []byte
+		typ        MessageType
+		compressed bool
+		started    bool
+	)
+	for {
+		f, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch f.opcode {
+		case opPing:
+			if err := ws.writeControl(opPong, f.payload); err != nil &&
+				!errors.Is(err, ErrCloseSent) {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			ws.closeReceived = true
+			return 0, nil, closeFrameError(f.payload)
+		case opText, opBinary:
+			if started {
+				return 0, nil, protocolError("expected continuation frame")
+			}
+			if f.rsv1 && !ws.compression {
+				return 0, nil, protocolError("unexpected compressed frame")
+			}
+			started, typ, compressed = true, MessageType(f.opcode), f.rsv1
+		case opContinuation:
+			if !started {
+				return 0, nil, protocolError("unexpected continuation frame")
+			}
+			if f.rsv1 {
+				return 0, nil, protocolError("compressed continuation frame")
+			}
+		default:
+			return 0, nil, protocolError("unknown opcode " + strconv.Itoa(int(f.opcode)))
+		}
+		if int64(len(message)+len(f.payload)) > ws.maxSize {
+			return 0, nil, &CloseError{Code: CloseMessageTooBig}
+		}
+		message = append(message, f.payload...)
+		if !f.fin {
+			continue
+		}
+		if compressed {
+			if message, err = ws.inflate(message); err != nil {
+				return 0, nil, err
+			}
+		}
+		if typ == TextMessage && !utf8.Valid(message) {
+			return 0, nil, &CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8"}
+		}
+		return typ, message, nil
+	}
+}
+
+type frame struct {
+	fin     bool
+	rsv1    bool
+	opcode  byte
+	payload []byte
+}
+
+// readFrame reads and unmasks a frame sent by the client.
+func (ws *WebSocket) readFrame() (frame, error) {
+	if ws.pingInterval > 0 {
+		ws.conn.SetReadDeadline(time.Now().Add(2 * ws.pingInterval))
+	}
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{fin: header[0]&0x80 != 0, rsv1: header[0]&0x40 != 0, opcode: header[0] & 0x0f}
+	if header[0]&0x30 != 0 {
+		return f, protocolError("reserved bits set")
+	}
+	if header[1]&0x80 == 0 {
+		return f, protocolError("unmasked client frame")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+			return f, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+			return f, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if f.opcode >= opClose && (length > 125 || !f.fin || f.rsv1) {
+		return f, protocolError("invalid control frame")
+	}
+	if length > uint64(ws.maxSize) {
+		return f, &CloseError{Code: CloseMessageTooBig}
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, f.payload); err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// closeFrameError returns the close code and reason of a close frame, or
+// the protocol error of an invalid one.
+func closeFrameError(payload []byte) *CloseError {
+	switch {
+	case len(payload) == 0:
+		return &CloseError{Code: CloseNoStatus}
+	case len(payload) == 1:
+		return protocolError("invalid close frame")
+	}
+	code := int(binary.BigEndian.Uint16(payload))
+	if !validCloseCode(code) {
+		return protocolError("invalid close code " + strconv.Itoa(code))
+	}
+	if !utf8.Valid(payload[2:]) {
+		return &CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8"}
+	}
+	return &CloseError{Code: code, Reason: string(payload[2:])}
+}
+
+func validCloseCode(code int) bool {
+	return code >= 1000 && code <= 1003 || code >= 1007 && code <= 1014 ||
+		code >= 3000 && code <= 4999
+}
+
+func protocolError(reason string) *CloseError {
+	return &CloseError{Code: CloseProtocolError, Reason: reason}
+}
+
+// inflate decompresses a permessage-deflate message.
+func (ws *WebSocket) inflate(data []byte) ([]byte, error) {
+	// restore the stripped flush marker and end the stream with an empty
+	// final block
+	reader := flate.NewReader(io.MultiReader(bytes.NewReader(data),
+		strings.NewReader("\x00\x00\xff\xff\x01\x00\x00\xff\xff")))
+	defer reader.Close()
+	message, err := io.ReadAll(io.LimitReader(reader, ws.maxSize+1))
+	if err != nil {
+		return nil, &CloseError{Code: CloseInvalidPayload, Reason: "invalid compressed data"}
+	}
+	if int64(len(message)) > ws.maxSize {
+		return nil, &CloseError{Code: CloseMessageTooBig}
+	}
+	return message, nil
+}
+
+// WriteMessage sends a text or binary message.
+func (ws *WebSocket) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return errors.New("mux: invalid websocket message type")
+	}
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	if !ws.compression {
+		return ws.writeFrame(byte(typ), false, data)
+	}
+	var buf bytes.Buffer
+	if ws.deflater == nil {
+		ws.deflater, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	} else {
+		ws.deflater.Reset(&buf)
+	}
+	if _, err := ws.deflater.Write(data); err != nil {
+		return err
+	}
+	if err := ws.deflater.Flush(); err != nil {
+		return err
+	}
+	return ws.writeFrame(byte(typ), true, bytes.TrimSuffix(buf.Bytes(), []byte{0, 0, 0xff, 0xff}))
+}
+
+// Ping sends a ping; the client answers with a pong carrying data.
+func (ws *WebSocket) Ping(data []byte) error {
+	if len(data) > 125 {
+		return errors.New("mux: websocket ping data exceeds 125 bytes")
+	}
+	return ws.writeControl(opPing, data)
+}
+
+// Close sends a close frame with code and reason; later writes return
+// ErrCloseSent. The connection is closed when the handler returns.
+func (ws *WebSocket) Close(code int, reason string) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return nil
+	}
+	ws.closeSent = true
+	var payload []byte
+	if code != CloseNoStatus {
+		if len(reason) > 123 {
+			reason = reason[:123]
+		}
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, reason...)
+	}
+	return ws.writeFrame(opClose, false, payload)
+}
+
+func (ws *WebSocket) writeControl(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	return ws.writeFrame(opcode, false, payload)
+}
+
+// writeFrame writes an unmasked frame; the caller holds writeMu.
+func (ws *WebSocket) writeFrame(opcode byte, rsv1 bool, payload []byte) error {
+	first := 0x80 | opcode
+	if rsv1 {
+		first |= 0x40
+	}
+	header := []byte{first}
+	switch length := len(payload); {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = binary.BigEndian.AppendUint16(append(header, 126), uint16(length))
+	default:
+		header = binary.BigEndian.AppendUint64(append(header, 127), uint64(length))
+	}
+	ws.writer.Write(header)
+	ws.writer.Write(payload)
+	return ws.writer.Flush()
+}
+
+// ping sends pings every interval until ctx is done.
+func (ws *WebSocket) ping(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(ws.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ws.Ping(nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// finish completes the close handshake after the handler returned with err
+// and closes the connection.
+func (ws *WebSocket) finish(err error) {
+	var closeErr *CloseError
+	switch {
+	case err == nil:
+		ws.Close(CloseNormal, "")
+	case errors.As(err, &closeErr):
+		ws.Close(closeErr.Code, closeErr.Reason)
+	case ws.readErr != nil:
+		// the connection failed
+	default:
+		slog.Error("mux.WebSocket: handler failed", "path", ws.r.URL.Path, "error", err)
+		ws.Close(CloseInternalError, "")
+	}
+	if !ws.closeReceived && ws.readErr == nil {
+		// wait for the client to answer the close frame
+		ws.pingInterval = 0
+		ws.conn.SetReadDeadline(time.Now().Add(websocketCloseTimeout))
+		for {
+			f, err := ws.readFrame()
+			if err != nil || f.opcode == opClose {
+				break
+			}
+		}
+	}
+	ws.conn.Close()
+}
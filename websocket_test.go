@@ -0,0 +1,456 @@
+package mux
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// wsClient is a minimal WebSocket client writing raw frames.
+type wsClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server, path string,
+	header http.Header,
+) (*wsClient, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsClient{t: t, conn: conn, reader: reader}, resp
+}
+
+func (c *wsClient) send(first byte, payload []byte) {
+	c.t.Helper()
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame := []byte{first}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(len(payload)))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 0x80|127), uint64(len(payload)))
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) receive() (byte, []byte) {
+	c.t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		c.t.Fatal("reading frame:", err)
+	}
+	if header[1]&0x80 != 0 {
+		c.t.Fatal("expected unmasked server frame")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		io.ReadFull(c.reader, extended[:])
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		io.ReadFull(c.reader, extended[:])
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		c.t.Fatal("reading payload:", err)
+	}
+	return header[0], payload
+}
+
+// expectClose reads the close frame of the server, checks its code and that
+// the server closes the connection.
+func (c *wsClient) expectClose(code int) {
+	c.t.Helper()
+	first, payload := c.receive()
+	if first != 0x80|opClose {
+		c.t.Fatalf("expected close frame, got %#x %q", first, payload)
+	}
+	got := CloseNoStatus
+	if len(payload) >= 2 {
+		got = int(binary.BigEndian.Uint16(payload))
+	}
+	if got != code {
+		c.t.Error("expected close code", code, "got", got, string(payload[min(2, len(payload)):]))
+	}
+	if _, err := c.reader.ReadByte(); err != io.EOF {
+		c.t.Error("expected connection closed, got", err)
+	}
+}
+
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func echo(_ context.Context, ws *WebSocket) error {
+	for {
+		typ, message, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if err := ws.WriteMessage(typ, message); err != nil {
+			return err
+		}
+	}
+}
+
+func newWebSocketServer(t *testing.T) *httptest.Server {
+	router := NewRouter(Logger)
+	router.WebSocketWithOptions("/echo", WebSocketOptions{
+		Subprotocols:   []string{"chat.v2", "chat.v1"},
+		Compression:    true,
+		MaxMessageSize: 1 << 17,
+	}, echo)
+	router.WebSocket("/fail", func(context.Context, *WebSocket) error {
+		return errors.New("database gone")
+	})
+	router.WebSocket("/policy", func(context.Context, *WebSocket) error {
+		return &CloseError{Code: ClosePolicyViolation, Reason: "banned"}
+	})
+	router.WebSocket("/room/{name}", func(_ context.Context, ws *WebSocket) error {
+		return ws.WriteMessage(TextMessage, []byte(ws.Request().PathValue("name")))
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	server := newWebSocketServer(t)
+
+	_, resp := dialWebSocket(t, server, "/echo", http.Header{
+		"Sec-Websocket-Protocol":   {"chat.v1, chat.v2"},
+		"Sec-Websocket-Extensions": {"x-webkit-deflate-frame, permessage-deflate"},
+	})
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" ||
+		resp.Header.Get("Sec-WebSocket-Protocol") != "chat.v2" ||
+		resp.Header.Get("Sec-WebSocket-Extensions") != deflateExtension {
+		t.Error("expected 101 with accept key, chat.v2 and deflate, got", resp.StatusCode,
+			resp.Header)
+	}
+
+	_, resp = dialWebSocket(t, server, "/echo", http.Header{
+		"Sec-Websocket-Extensions": {"permessage-deflate; server_max_window_bits=10"},
+	})
+	if resp.Header.Get("Sec-WebSocket-Extensions") != "" {
+		t.Error("expected unsupported window size to be declined, got",
+			resp.Header.Get("Sec-WebSocket-Extensions"))
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"version", http.Header{"Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"key", http.Header{"Sec-Websocket-Key": {"short"}}, http.StatusBadRequest},
+		{"upgrade", http.Header{"Upgrade": {"h2c"}}, http.StatusBadRequest},
+		{"origin", http.Header{"Origin": {"https://evil.example"}}, http.StatusForbidden},
+		{"same origin", http.Header{"Origin": {"http://" + server.Listener.Addr().String()}},
+			http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		_, resp := dialWebSocket(t, server, "/echo", tt.header)
+		if resp.StatusCode != tt.status {
+			t.Error(tt.name, "expected", tt.status, "got", resp.StatusCode)
+		}
+	}
+}
+
+func TestAllowOrigin(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://api.example.com/ws", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	if !allowOrigin(req, []string{"*.example.com"}) || allowOrigin(req, []string{"example.com"}) ||
+		!allowOrigin(req, []string{"*"}) {
+		t.Error("expected origin patterns to match hosts")
+	}
+}
+
+// TestWebSocketConformance follows the sections of the Autobahn test suite.
+func TestWebSocketConformance(t *testing.T) {
+	server := newWebSocketServer(t)
+	dial := func() *wsClient {
+		client, resp := dialWebSocket(t, server, "/echo", nil)
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatal("expected", http.StatusSwitchingProtocols, "got", resp.StatusCode)
+		}
+		return client
+	}
+	expectEcho := func(client *wsClient, first byte, want []byte) {
+		t.Helper()
+		got, payload := client.receive()
+		if got != first || !bytes.Equal(payload, want) {
+			t.Errorf("expected %#x with %d bytes, got %#x with %d bytes", first, len(want),
+				got, len(payload))
+		}
+	}
+
+	t.Run("1 framing", func(t *testing.T) {
+		client := dial()
+		for _, size := range []int{0, 125, 126, 65535, 65536} {
+			payload := bytes.Repeat([]byte("*"), size)
+			client.send(0x80|opText, payload)
+			expectEcho(client, 0x80|opText, payload)
+			client.send(0x80|opBinary, payload)
+			expectEcho(client, 0x80|opBinary, payload)
+		}
+		client.send(0x80|opClose, closePayload(CloseNormal, ""))
+		client.expectClose(CloseNormal)
+	})
+
+	t.Run("2 pings and pongs", func(t *testing.T) {
+		client := dial()
+		client.send(0x80|opPing, []byte("hello"))
+		expectEcho(client, 0x80|opPong, []byte("hello"))
+		client.send(0x80|opPong, []byte("unsolicited"))
+		client.send(0x80|opText, []byte("after pong"))
+		expectEcho(client, 0x80|opText, []byte("after pong"))
+		client.send(0x80|opPing, bytes.Repeat([]byte("x"), 126))
+		client.expectClose(CloseProtocolError)
+	})
+
+	protocolErrors := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"3 reserved bit", [][]byte{{0x80 | 0x20 | opText}}},
+		{"4 reserved data opcode", [][]byte{{0x80 | 0x3}}},
+		{"4 reserved control opcode", [][]byte{{0x80 | 0xb}}},
+		{"5 continuation without start", [][]byte{{0x80 | opContinuation}}},
+		{"5 text during fragmented message", [][]byte{{opText}, {0x80 | opText}}},
+		{"5 fragmented ping", [][]byte{{opPing}}},
+		{"7 one byte close", [][]byte{{0x80 | opClose, 0}}},
+		{"12 compressed control frame", [][]byte{{0x80 | 0x40 | opPing}}},
+	}
+	for _, tt := range protocolErrors {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dial()
+			for _, frame := range tt.frames {
+				client.send(frame[0], frame[1:])
+			}
+			client.expectClose(CloseProtocolError)
+		})
+	}
+
+	t.Run("5 fragmentation", func(t *testing.T) {
+		client := dial()
+		client.send(opText, []byte("frag"))
+		client.send(0x80|opPing, []byte("between"))
+		client.send(opContinuation, []byte("men"))
+		client.send(0x80|opContinuation, []byte("ted"))
+		expectEcho(client, 0x80|opPong, []byte("between"))
+		expectEcho(client, 0x80|opText, []byte("fragmented"))
+	})
+
+	t.Run("6 utf-8", func(t *testing.T) {
+		client := dial()
+		euro := []byte("€")
+		client.send(opText, euro[:1])
+		client.send(0x80|opContinuation, euro[1:])
+		expectEcho(client, 0x80|opText, euro)
+		client.send(0x80|opText, []byte{0xce, 0xba, 0xe1, 0xbd, 0xb9, 0xcf, 0x83, 0xce, 0xbc,
+			0xce, 0xb5, 0xed, 0xa0, 0x80, 0x65, 0x64, 0x69, 0x74, 0x65, 0x64})
+		client.expectClose(CloseInvalidPayload)
+	})
+
+	closeCodes := []struct {
+		payload []byte
+		want    int
+	}{
+		{nil, CloseNoStatus},
+		{closePayload(CloseGoingAway, "bye"), CloseGoingAway},
+		{closePayload(3000, ""), 3000},
+		{closePayload(4999, ""), 4999},
+		{closePayload(999, ""), CloseProtocolError},
+		{closePayload(1004, ""), CloseProtocolError},
+		{closePayload(1005, ""), CloseProtocolError},
+		{closePayload(1006, ""), CloseProtocolError},
+		{closePayload(1016, ""), CloseProtocolError},
+		{closePayload(2999, ""), CloseProtocolError},
+		{closePayload(5000, ""), CloseProtocolError},
+		{closePayload(CloseNormal, "\xff"), CloseInvalidPayload},
+	}
+	for _, tt := range closeCodes {
+		t.Run("7 close", func(t *testing.T) {
+			client := dial()
+			client.send(0x80|opClose, tt.payload)
+			client.expectClose(tt.want)
+		})
+	}
+
+	t.Run("9 limits", func(t *testing.T) {
+		client := dial()
+		client.send(opBinary, bytes.Repeat([]byte("x"), 1<<16))
+		client.send(0x80|opContinuation, bytes.Repeat([]byte("x"), 1<<16+1))
+		client.expectClose(CloseMessageTooBig)
+	})
+}
+
+func TestWebSocketCompression(t *testing.T) {
+	server := newWebSocketServer(t)
+	client, resp := dialWebSocket(t, server, "/echo", http.Header{
+		"Sec-Websocket-Extensions": {"permessage-deflate; client_max_window_bits"},
+	})
+	if resp.Header.Get("Sec-WebSocket-Extensions") != deflateExtension {
+		t.Fatal("expected deflate, got", resp.Header.Get("Sec-WebSocket-Extensions"))
+	}
+	message := []byte(strings.Repeat("compressible ", 100))
+	var buf bytes.Buffer
+	writer, _ := flate.NewWriter(&buf, flate.BestCompression)
+	writer.Write(message)
+	writer.Flush()
+	client.send(0x80|0x40|opText, bytes.TrimSuffix(buf.Bytes(), []byte{0, 0, 0xff, 0xff}))
+
+	first, payload := client.receive()
+	if first != 0x80|0x40|opText || len(payload) >= len(message) {
+		t.Fatalf("expected compressed text frame, got %#x with %d bytes", first, len(payload))
+	}
+	reader := flate.NewReader(io.MultiReader(bytes.NewReader(payload),
+		strings.NewReader("\x00\x00\xff\xff\x01\x00\x00\xff\xff")))
+	got, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(got, message) {
+		t.Error("expected echoed message, got", err, len(got))
+	}
+
+	client.send(0x80|0x40|opBinary, []byte{0xff, 0xff, 0xff})
+	client.expectClose(CloseInvalidPayload)
+}
+
+func TestWebSocketHandlerClose(t *testing.T) {
+	server := newWebSocketServer(t)
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/fail", CloseInternalError},
+		{"/policy", ClosePolicyViolation},
+		{"/room/lobby", CloseNormal},
+	}
+	for _, tt := range tests {
+		client, _ := dialWebSocket(t, server, tt.path, nil)
+		if tt.path == "/room/lobby" {
+			if _, payload := client.receive(); string(payload) != "lobby" {
+				t.Errorf("Expected 'lobby', got '%s'", payload)
+			}
+		}
+		first, payload := client.receive()
+		if first != 0x80|opClose || int(binary.BigEndian.Uint16(payload)) != tt.want {
+			t.Error(tt.path, "expected close", tt.want, "got", first, payload)
+		}
+		client.send(0x80|opClose, payload[:2])
+		if _, err := client.reader.ReadByte(); err != io.EOF {
+			t.Error("expected connection closed, got", err)
+		}
+	}
+}
+
+func TestWebSocketHijackNotSupported(t *testing.T) {
+	router := NewRouter()
+	router.WebSocket("/ws", echo)
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Error("expected", http.StatusInternalServerError, "got", w.Code)
+	}
+}
+
+// syncBuffer collects the error log of a test server.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWebSocketMiddleware(t *testing.T) {
+	router := NewRouter(Timeout(20*time.Millisecond), ServerTiming(ServerTimingOptions{}),
+		MaxBodySize(16))
+	router.WebSocket("/ws", echo)
+	done := make(chan struct{}, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			router.ServeHTTP(w, r)
+			done <- struct{}{}
+		}))
+	errorLog := &syncBuffer{}
+	server.Config.ErrorLog = log.New(errorLog, "", 0)
+	server.Start()
+	defer server.Close()
+
+	client, resp := dialWebSocket(t, server, "/ws", nil)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("expected", http.StatusSwitchingProtocols, "got", resp.StatusCode)
+	}
+	time.Sleep(60 * time.Millisecond)
+	message := []byte(strings.Repeat("a", 64))
+	client.send(0x80|opText, message)
+	if _, payload := client.receive(); !bytes.Equal(payload, message) {
+		t.Errorf("Expected '%s', got '%s'", message, payload)
+	}
+	client.send(0x80|opClose, closePayload(CloseNormal, ""))
+	client.expectClose(CloseNormal)
+	<-done
+	if errorLog.String() != "" {
+		t.Error("expected no server errors, got", errorLog.String())
+	}
+}